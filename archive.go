@@ -0,0 +1,127 @@
+package nut
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Limits for nut archives.
+var (
+	MaxNutSize          int64 = 64 << 20  // maximal size of .nut file
+	MaxUncompressedSize int64 = 256 << 20 // maximal total uncompressed size of files in nut
+	MaxFiles                  = 10000     // maximal number of files in nut
+)
+
+// Modification time of all files in nut. Together with fixed mode, compression method and level it makes packing
+// reproducible: nuts packed from the same files by the same Go version are byte-identical
+// (output of compress/flate may change between Go releases).
+var NutFileTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Compression level of files in nut.
+const nutCompressionLevel = flate.BestCompression
+
+// Returns normalized zip header for file in nut with given name.
+func NewFileHeader(name string) *zip.FileHeader {
+	fh := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: NutFileTime}
+	fh.SetMode(0644)
+	return fh
+}
+
+// Returns zip writer compressing files with nutCompressionLevel.
+func newZipWriter(w io.Writer) *zip.Writer {
+	zw := zip.NewWriter(w)
+	zw.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, nutCompressionLevel)
+	})
+	return zw
+}
+
+// Checks that file name is safe to use in nut: relative, clean, slash-separated, without ".." elements.
+func CheckFileName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("File name is empty.")
+	case strings.ContainsAny(name, "\\\x00"):
+		return fmt.Errorf("File name %q contains invalid characters.", name)
+	case path.IsAbs(name) || (len(name) > 1 && name[1] == ':'):
+		return fmt.Errorf("File name %q is absolute.", name)
+	case name == ".." || strings.HasPrefix(name, "../"):
+		return fmt.Errorf("File name %q points outside of nut.", name)
+	case path.Clean(name) != name || name == ".":
+		return fmt.Errorf("File name %q is not clean.", name)
+	}
+	return nil
+}
+
+// Checks nut archive: file names should be safe and unique (case-insensitively), files should not collide
+// with directories, only regular files and directories are allowed.
+// Also checks number of files and total uncompressed size against MaxFiles and MaxUncompressedSize.
+// Actual uncompressed size can't exceed declared one: archive/zip returns error on read in that case.
+func CheckArchive(r *zip.Reader) error {
+	if len(r.File) > MaxFiles {
+		return fmt.Errorf("Nut contains too many files: %d (max %d).", len(r.File), MaxFiles)
+	}
+
+	var total uint64
+	files := make(map[string]string, len(r.File)) // lower case name => name
+	dirs := make(map[string]string)               // lower case name => name
+	for _, f := range r.File {
+		mode := f.Mode()
+		name := f.Name
+		if mode.IsDir() {
+			name = strings.TrimSuffix(name, "/")
+		}
+		if err := CheckFileName(name); err != nil {
+			return err
+		}
+		if !mode.IsRegular() && !mode.IsDir() {
+			return fmt.Errorf("File %q has unsupported type %s.", name, mode&os.ModeType)
+		}
+
+		total += f.UncompressedSize64
+		if total > uint64(MaxUncompressedSize) {
+			return fmt.Errorf("Nut files are too big: more than %d bytes uncompressed.", MaxUncompressedSize)
+		}
+
+		// check name and parent directories
+		lower := strings.ToLower(name)
+		if other, ok := files[lower]; ok {
+			return fmt.Errorf("File %q duplicates %q.", name, other)
+		}
+		if other, ok := dirs[lower]; ok && !mode.IsDir() {
+			return fmt.Errorf("File %q collides with directory %q.", name, other)
+		}
+		if mode.IsDir() {
+			dirs[lower] = name
+		} else {
+			files[lower] = name
+		}
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			lowerDir := strings.ToLower(dir)
+			if other, ok := files[lowerDir]; ok {
+				return fmt.Errorf("Directory %q of file %q collides with file %q.", dir, name, other)
+			}
+			dirs[lowerDir] = dir
+		}
+	}
+
+	return nil
+}
+
+// Returns content of file in nut.
+func readFile(f *zip.File) (b []byte, err error) {
+	r, err := f.Open()
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,103 @@
+package nut_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+
+	. "."
+	. "launchpad.net/gocheck"
+)
+
+type A struct{}
+
+var _ = Suite(&A{})
+
+// Returns zip archive with given files; file content is file name.
+func makeZip(c *C, files []string, modes ...os.FileMode) *zip.Reader {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for i, name := range files {
+		fh := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		fh.SetMode(0644)
+		if i < len(modes) {
+			fh.SetMode(modes[i])
+		}
+		f, err := w.CreateHeader(fh)
+		c.Assert(err, IsNil)
+		if !fh.Mode().IsDir() {
+			_, err = f.Write([]byte(name))
+			c.Assert(err, IsNil)
+		}
+	}
+	c.Assert(w.Close(), IsNil)
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, IsNil)
+	return r
+}
+
+func (*A) TestCheckFileName(c *C) {
+	for _, name := range []string{"nut.json", "LICENSE", "sub/file.go", "testdata/a.b/c", "..a", "a..b"} {
+		c.Check(CheckFileName(name), IsNil, Commentf("%q", name))
+	}
+
+	for _, name := range []string{"", ".", "..", "../a", "../../etc/passwd", "/etc/passwd", "C:/a", "c:a",
+		"a\\\\b", "..\\\\a", "a/../b", "./a", "a//b", "a/", "a/.", "a\\x00b"} {
+		c.Check(CheckFileName(name), Not(IsNil), Commentf("%q", name))
+	}
+}
+
+func (*A) TestCheckArchive(c *C) {
+	c.Check(CheckArchive(makeZip(c, []string{"a.go", "sub/b.go", "sub/c.go", "nut.json"})), IsNil)
+	c.Check(CheckArchive(makeZip(c, []string{"sub/", "sub/b.go"}, os.ModeDir|0755, 0644)), IsNil)
+
+	c.Check(CheckArchive(makeZip(c, []string{"a.go", "../a.go"})), ErrorMatches, `File name "../a.go" points outside of nut.`)
+	c.Check(CheckArchive(makeZip(c, []string{"/tmp/a.go"})), ErrorMatches, `File name "/tmp/a.go" is absolute.`)
+	c.Check(CheckArchive(makeZip(c, []string{"a.go", "a.go"})), ErrorMatches, `File "a.go" duplicates "a.go".`)
+	c.Check(CheckArchive(makeZip(c, []string{"README", "readme"})), ErrorMatches, `File "readme" duplicates "README".`)
+	c.Check(CheckArchive(makeZip(c, []string{"sub", "sub/a.go"})), ErrorMatches, `Directory "sub" of file "sub/a.go" collides with file "sub".`)
+	c.Check(CheckArchive(makeZip(c, []string{"Sub/a.go", "sub"})), ErrorMatches, `File "sub" collides with directory "Sub".`)
+	c.Check(CheckArchive(makeZip(c, []string{"link"}, os.ModeSymlink|0777)), ErrorMatches, `File "link" has unsupported type L---------.`)
+}
+
+func (*A) TestCheckArchiveLimits(c *C) {
+	oldFiles, oldSize := MaxFiles, MaxUncompressedSize
+	defer func() {
+		MaxFiles, MaxUncompressedSize = oldFiles, oldSize
+	}()
+
+	MaxFiles = 2
+	c.Check(CheckArchive(makeZip(c, []string{"a", "b"})), IsNil)
+	c.Check(CheckArchive(makeZip(c, []string{"a", "b", "c"})), ErrorMatches, `Nut contains too many files: 3 \(max 2\).`)
+
+	MaxUncompressedSize = 10
+	c.Check(CheckArchive(makeZip(c, []string{"12345", "67890"})), IsNil)
+	c.Check(CheckArchive(makeZip(c, []string{"12345", "678901"})), ErrorMatches, `Nut files are too big: more than 10 bytes uncompressed.`)
+}
+
+func (*A) TestNutFileReadFromBad(c *C) {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for _, name := range []string{"../evil.go", "nut.json"} {
+		f, err := w.Create(name)
+		c.Assert(err, IsNil)
+		_, err = f.Write([]byte("{}"))
+		c.Assert(err, IsNil)
+	}
+	c.Assert(w.Close(), IsNil)
+
+	nf := new(NutFile)
+	_, err := nf.ReadFrom(bytes.NewReader(buf.Bytes()))
+	c.Check(err, ErrorMatches, `File name "../evil.go" points outside of nut.`)
+
+	old := MaxNutSize
+	defer func() {
+		MaxNutSize = old
+	}()
+	MaxNutSize = int64(buf.Len() - 1)
+	_, err = nf.ReadFrom(bytes.NewReader(buf.Bytes()))
+	c.Check(err, ErrorMatches, `NutFile.ReadFrom: nut is too big: more than \d+ bytes.`)
+	err = nf.OpenReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Check(err, ErrorMatches, `NutFile.OpenReaderAt: nut is too big: \d+ bytes \(max \d+\).`)
+}
@@ -0,0 +1,150 @@
+package nut
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Describes custom check rules. Checkers are registered with RegisterChecker
+// and run by Nut.Findings and NutFile.Findings.
+type NutChecker interface {
+	// Returns codes and default severities of rules reported by checker.
+	DefaultRules() Rules
+
+	// Checks nut and returns findings (see NewFinding). Files provide nut content:
+	// nut file itself, or nut directory for nut read from directory; files may be nil.
+	Check(nut *Nut, files fs.FS) []Finding
+}
+
+var checkers []NutChecker
+
+// Registers checker and adds its rules to DefaultRules. It should be called during initialization.
+// It panics if checker reports rule which is already known.
+func RegisterChecker(c NutChecker) {
+	rules := c.DefaultRules()
+	for code := range rules {
+		if _, ok := DefaultRules[code]; ok {
+			panic(fmt.Sprintf("nut: RegisterChecker: rule %q is already registered", code))
+		}
+	}
+	for code, severity := range rules {
+		DefaultRules[code] = severity
+	}
+	checkers = append(checkers, c)
+}
+
+// Returns registered checkers.
+func Checkers() []NutChecker {
+	return append([]NutChecker(nil), checkers...)
+}
+
+// Runs registered checkers, setting default severities for findings without them.
+func runCheckers(nut *Nut, files fs.FS) (findings []Finding) {
+	for _, c := range checkers {
+		for _, f := range c.Check(nut, files) {
+			if f.Severity == "" {
+				f.Severity = DefaultRules[f.Rule]
+			}
+			if f.Severity == "" {
+				f.Severity = SeverityError
+			}
+			findings = append(findings, f)
+		}
+	}
+	return
+}
+
+// Checker which runs external executable (plugin) as "<Path> <Args...> <dir>",
+// where dir is temporary directory with nut files (including nut.json).
+// Executable should print JSON array of findings to stdout, e.g.
+// [{"Rule": "org-copyright", "File": "a.go", "Message": "No copyright header."}].
+// Findings without Severity get default severity from Rules.
+type ExecChecker struct {
+	Path  string
+	Args  []string `json:",omitempty"`
+	Rules Rules    // codes and default severities of rules reported by executable
+}
+
+// Returns ec.Rules.
+func (ec *ExecChecker) DefaultRules() Rules {
+	return ec.Rules
+}
+
+// Runs executable with nut files. Failures are reported as findings of rule RuleChecker.
+func (ec *ExecChecker) Check(nut *Nut, files fs.FS) (findings []Finding) {
+	if files == nil {
+		return
+	}
+
+	err := ec.run(files, &findings)
+	if err != nil {
+		findings = []Finding{NewFinding(RuleChecker, "", "", "Checker %s failed: %s", ec.Path, err)}
+	}
+	return
+}
+
+func (ec *ExecChecker) run(files fs.FS, findings *[]Finding) (err error) {
+	dir, err := ioutil.TempDir("", "nut-check-")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	err = copyFS(dir, files)
+	if err != nil {
+		return
+	}
+
+	var stdout, stderr bytes.Buffer
+	c := exec.Command(ec.Path, append(ec.Args, dir)...)
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	err = c.Run()
+	if err != nil {
+		if s := strings.TrimSpace(stderr.String()); s != "" {
+			err = fmt.Errorf("%s\n%s", err, s)
+		}
+		return
+	}
+
+	err = json.Unmarshal(stdout.Bytes(), findings)
+	if err != nil {
+		err = fmt.Errorf("Can't parse output: %s", err)
+	}
+	return
+}
+
+// Copies regular files from fsys into directory dir, skipping version control directories.
+func copyFS(dir string, fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch d.Name() {
+		case ".git", ".hg", ".svn", ".bzr":
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(dst), unpackDirPerm); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(dst, b, 0644)
+	})
+}
@@ -0,0 +1,102 @@
+package nut_test
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	. "."
+	. "launchpad.net/gocheck"
+)
+
+type Ch struct{}
+
+var _ = Suite(&Ch{})
+
+// Requires copyright header in Go files of nuts by vendor "org".
+type copyrightChecker struct{}
+
+func (copyrightChecker) DefaultRules() Rules {
+	return Rules{"org-copyright": SeverityWarning}
+}
+
+func (copyrightChecker) Check(nut *Nut, files fs.FS) (findings []Finding) {
+	if nut.Vendor != "org" || files == nil {
+		return
+	}
+	for _, name := range nut.GoFiles {
+		b, err := fs.ReadFile(files, name)
+		if err != nil || !strings.HasPrefix(string(b), "// Copyright") {
+			findings = append(findings, NewFinding("org-copyright", "", name, "No copyright header in %s.", name))
+		}
+	}
+	return
+}
+
+func init() {
+	RegisterChecker(copyrightChecker{})
+}
+
+func (*Ch) TestRegisterChecker(c *C) {
+	c.Check(DefaultRules["org-copyright"], Equals, SeverityWarning)
+	c.Check(func() { RegisterChecker(copyrightChecker{}) }, PanicMatches, `nut: RegisterChecker: rule "org-copyright" is already registered`)
+	c.Check(Checkers(), HasLen, 1)
+
+	files := map[string]string{
+		"a.go":     "// Package a is used to test nut.\npackage a\n",
+		"b.go":     "// Copyright Org.\n\npackage a\n",
+		"LICENSE":  "license",
+		"nut.json": `{"Version": "0.0.1", "Vendor": "org", "Authors": [{"FullName": "Alexey Palazhchenko"}], "ExtraFiles": ["LICENSE"]}`,
+	}
+	nf := new(NutFile)
+	_, err := nf.ReadFrom(makeNut(c, files, []string{"LICENSE", "a.go", "b.go", "nut.json"}, nil))
+	c.Assert(err, IsNil)
+	c.Check(nf.Findings(), DeepEquals, []Finding{
+		{Rule: "org-copyright", Severity: SeverityWarning, File: "a.go", Message: "No copyright header in a.go."},
+	})
+
+	nf.Rules = Rules{"org-copyright": SeverityError}
+	c.Check(FindingStrings(FilterFindings(nf.Findings(), SeverityError)), DeepEquals, []string{"No copyright header in a.go."})
+
+	// nut from directory
+	dir := c.MkDir()
+	for name, content := range files {
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644), IsNil)
+	}
+	nut, _, err := PackFiles(dir, nil)
+	c.Assert(err, IsNil)
+	c.Check(nut.Check(), DeepEquals, []string{"No copyright header in a.go."})
+}
+
+func (*Ch) TestExecChecker(c *C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("shell script")
+	}
+
+	dir := c.MkDir()
+	script := filepath.Join(dir, "check.sh")
+	c.Assert(ioutil.WriteFile(script, []byte(`#!/bin/sh
+if grep -q TODO "$1/a.go"; then
+	echo '[{"Rule": "org-todo", "File": "a.go", "Message": "TODO in a.go."}]'
+else
+	echo '[]'
+fi
+`), 0755), IsNil)
+
+	ec := &ExecChecker{Path: "/bin/sh", Args: []string{script}, Rules: Rules{"org-todo": SeverityWarning}}
+	files := map[string]string{"a.go": "package a // TODO\n", "nut.json": `{"Vendor": "debug"}`}
+	nf := new(NutFile)
+	_, err := nf.ReadFrom(makeNut(c, files, []string{"a.go", "nut.json"}, nil))
+	c.Assert(err, IsNil)
+	c.Check(ec.Check(&nf.Nut, nf), DeepEquals, []Finding{{Rule: "org-todo", File: "a.go", Message: "TODO in a.go."}})
+	c.Check(ec.Check(&nf.Nut, nil), HasLen, 0)
+
+	ec.Args = []string{filepath.Join(dir, "missing.sh")}
+	findings := ec.Check(&nf.Nut, nf)
+	c.Assert(findings, HasLen, 1)
+	c.Check(findings[0].Rule, Equals, RuleChecker)
+	c.Check(findings[0].Severity, Equals, SeverityError)
+	c.Check(findings[0].Message, Matches, `(?s)Checker /bin/sh failed: exit status \d+.*missing.sh.*`)
+}
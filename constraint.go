@@ -0,0 +1,282 @@
+package nut
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Describes version constraint: a set of rules version should satisfy.
+//
+// Constraint consists of one or more alternatives separated by "||".
+// Each alternative is a whitespace-separated list of comparisons, all of which should be satisfied.
+// Supported comparisons:
+//
+//	1.2.3, =1.2.3  exactly 1.2.3;
+//	>1.2.3, >=1.2.3, <1.2.3, <=1.2.3  ordinary comparisons;
+//	~1.2.3  >=1.2.3 <1.3.0 (patch-level changes);
+//	^1.2.3  >=1.2.3 <2.0.0 (changes which do not modify left-most non-zero component);
+//	1.2, 1.2.x, ~1.2  >=1.2.0 <1.3.0;
+//	1, 1.x, ~1, ^1  >=1.0.0 <2.0.0;
+//	^1.3  >=1.3.0 <2.0.0;
+//	^0.2.1  >=0.2.1 <0.3.0;
+//	*, x  any version.
+//
+// Pre-release versions satisfy constraint only if some comparison in the same alternative
+// has pre-release version with the same major, minor and patch numbers.
+// Build metadata is ignored.
+type Constraint struct {
+	s            string
+	alternatives [][]comparison
+}
+
+type comparison struct {
+	op string
+	v  Version
+}
+
+// Parse and return constraint.
+func NewConstraint(constraint string) (c *Constraint, err error) {
+	c = new(Constraint)
+	err = c.setConstraint(constraint)
+	return
+}
+
+// Return constraint as string.
+func (c Constraint) String() string {
+	return c.s
+}
+
+// Returns true if version satisfies constraint, false otherwise.
+func (c *Constraint) Check(v *Version) bool {
+	for _, alt := range c.alternatives {
+		if checkAlternative(alt, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the highest version from the list which satisfies constraint, or nil if none of them does.
+func (c *Constraint) Highest(versions []*Version) (highest *Version) {
+	for _, v := range versions {
+		if c.Check(v) && (highest == nil || highest.Less(v)) {
+			highest = v
+		}
+	}
+	return
+}
+
+// Marshal to JSON.
+func (c *Constraint) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(c.String())), nil
+}
+
+// Unmarshal from JSON.
+func (c *Constraint) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return fmt.Errorf("Bad JSON for constraint %s: %s", b, err)
+	}
+	return c.setConstraint(s)
+}
+
+func checkAlternative(alt []comparison, v *Version) bool {
+	preAllowed := !v.IsPreRelease()
+	for _, cmp := range alt {
+		res := v.Compare(&cmp.v)
+		var ok bool
+		switch cmp.op {
+		case "=":
+			ok = res == 0
+		case ">":
+			ok = res > 0
+		case ">=":
+			ok = res >= 0
+		case "<":
+			ok = res < 0
+		case "<=":
+			ok = res <= 0
+		default:
+			panic(fmt.Errorf("Unexpected operator %q", cmp.op))
+		}
+		if !ok {
+			return false
+		}
+
+		if cmp.v.IsPreRelease() && cmp.v.Major == v.Major && cmp.v.Minor == v.Minor && cmp.v.Patch == v.Patch {
+			preAllowed = true
+		}
+	}
+	return preAllowed
+}
+
+func (c *Constraint) setConstraint(constraint string) (err error) {
+	var res Constraint
+	var alts []string
+	for _, a := range strings.Split(constraint, "||") {
+		fields := strings.Fields(a)
+		if len(fields) == 0 {
+			err = fmt.Errorf("Bad constraint %q: empty alternative.", constraint)
+			return
+		}
+
+		var alt []comparison
+		var tokens []string
+		for i := 0; i < len(fields); i++ {
+			token := fields[i]
+
+			// allow space between operator and version: ">= 1.2.0"
+			if strings.Trim(token, "=<>~^") == "" && i+1 < len(fields) {
+				i++
+				token += fields[i]
+			}
+			tokens = append(tokens, token)
+
+			var cmps []comparison
+			cmps, err = parseComparison(token)
+			if err != nil {
+				err = fmt.Errorf("Bad constraint %q: %s", constraint, err)
+				return
+			}
+			alt = append(alt, cmps...)
+		}
+		res.alternatives = append(res.alternatives, alt)
+		alts = append(alts, strings.Join(tokens, " "))
+	}
+
+	res.s = strings.Join(alts, " || ")
+	*c = res
+	return
+}
+
+// Parses single comparison like "^1.2" and converts it to list of simple comparisons.
+func parseComparison(s string) (cmps []comparison, err error) {
+	op := s[:len(s)-len(strings.TrimLeft(s, "=<>~^"))]
+	switch op {
+	case "", "=", ">", ">=", "<", "<=", "~", "^":
+	default:
+		err = fmt.Errorf("unknown operator %q.", op)
+		return
+	}
+
+	p, n, err := parsePartial(s[len(op):])
+	if err != nil {
+		return
+	}
+
+	// next major, minor and patch versions
+	nextMajor := Version{Major: p.Major + 1}
+	nextMinor := Version{Major: p.Major, Minor: p.Minor + 1}
+	nextPatch := Version{Major: p.Major, Minor: p.Minor, Patch: p.Patch + 1}
+
+	// any version
+	if n == 0 {
+		switch op {
+		case "", "=", ">=", "<=", "~", "^":
+			cmps = []comparison{{">=", Version{}}}
+		default:
+			err = fmt.Errorf("operator %q can't be used with wildcard.", op)
+		}
+		return
+	}
+
+	// upper bound for partial version: 1.2 => 1.3.0, 1 => 2.0.0
+	upper := nextMinor
+	if n == 1 {
+		upper = nextMajor
+	}
+
+	switch op {
+	case "", "=":
+		if n == 3 {
+			cmps = []comparison{{"=", p}}
+		} else {
+			cmps = []comparison{{">=", p}, {"<", upper}}
+		}
+
+	case ">":
+		if n == 3 {
+			cmps = []comparison{{">", p}}
+		} else {
+			cmps = []comparison{{">=", upper}}
+		}
+
+	case ">=", "<":
+		cmps = []comparison{{op, p}}
+
+	case "<=":
+		if n == 3 {
+			cmps = []comparison{{"<=", p}}
+		} else {
+			cmps = []comparison{{"<", upper}}
+		}
+
+	case "~":
+		cmps = []comparison{{">=", p}, {"<", upper}}
+
+	case "^":
+		switch {
+		case p.Major != 0 || n == 1:
+			upper = nextMajor
+		case p.Minor != 0 || n == 2:
+			upper = nextMinor
+		default:
+			upper = nextPatch
+		}
+		cmps = []comparison{{">=", p}, {"<", upper}}
+	}
+
+	return
+}
+
+// Parses possibly partial version like "1", "1.2", "1.x" or "*".
+// Returns version with missing components set to zero and number of given components.
+func parsePartial(s string) (v Version, n int, err error) {
+	if s == "" {
+		err = fmt.Errorf("version expected.")
+		return
+	}
+
+	// full version
+	if VersionRegexp.MatchString(s) {
+		err = v.setVersion(s)
+		n = 3
+		return
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		err = fmt.Errorf("bad format for version %q.", s)
+		return
+	}
+	for i, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			// all next parts should be wildcards too
+			for _, rest := range parts[i+1:] {
+				if rest != "x" && rest != "X" && rest != "*" {
+					err = fmt.Errorf("bad format for version %q.", s)
+					return
+				}
+			}
+			break
+		}
+
+		var num int
+		num, err = strconv.Atoi(part)
+		if err != nil || num < 0 || (len(part) > 1 && part[0] == '0') || strings.HasPrefix(part, "+") {
+			err = fmt.Errorf("bad format for version %q.", s)
+			return
+		}
+		switch i {
+		case 0:
+			v.Major = num
+		case 1:
+			v.Minor = num
+		case 2:
+			v.Patch = num
+		}
+		n++
+	}
+	return
+}
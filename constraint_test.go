@@ -0,0 +1,105 @@
+package nut_test
+
+import (
+	"encoding/json"
+
+	. "."
+	. "launchpad.net/gocheck"
+)
+
+type K struct{}
+
+var _ = Suite(&K{})
+
+func (*K) TestCheck(c *C) {
+	data := []struct {
+		constraint string
+		matches    []string
+		notMatches []string
+	}{
+		{">=1.2.0 <2.0.0", []string{"1.2.0", "1.2.1", "1.9.9"}, []string{"1.1.9", "2.0.0", "2.0.0-rc.1", "1.5.0-beta"}},
+		{">= 1.2.0  < 2.0.0", []string{"1.2.0", "1.9.9"}, []string{"2.0.0"}},
+		{"^1.3", []string{"1.3.0", "1.3.5", "1.9.0"}, []string{"1.2.9", "2.0.0"}},
+		{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"1.2.2", "2.0.0"}},
+		{"^0.2.1", []string{"0.2.1", "0.2.9"}, []string{"0.2.0", "0.3.0"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.2", "0.0.4"}},
+		{"^0.0", []string{"0.0.0", "0.0.9"}, []string{"0.1.0"}},
+		{"~0.2.1", []string{"0.2.1", "0.2.9"}, []string{"0.2.0", "0.3.0"}},
+		{"~1.2", []string{"1.2.0", "1.2.9"}, []string{"1.1.0", "1.3.0"}},
+		{"~1", []string{"1.0.0", "1.9.0"}, []string{"0.9.0", "2.0.0"}},
+		{"1.x", []string{"1.0.0", "1.9.9"}, []string{"0.9.9", "2.0.0"}},
+		{"1.2.x", []string{"1.2.0", "1.2.9"}, []string{"1.1.9", "1.3.0"}},
+		{"1", []string{"1.0.0", "1.9.9"}, []string{"2.0.0"}},
+		{"*", []string{"0.0.0", "1.2.3", "10.0.0"}, []string{"1.0.0-rc.1"}},
+		{"1.2.3", []string{"1.2.3", "1.2.3+build.5"}, []string{"1.2.4", "1.2.3-rc.1"}},
+		{"=1.2.3", []string{"1.2.3"}, []string{"1.2.2"}},
+		{">1.2.3", []string{"1.2.4"}, []string{"1.2.3"}},
+		{">1.2", []string{"1.3.0"}, []string{"1.2.9"}},
+		{"<=1.2", []string{"1.2.9"}, []string{"1.3.0"}},
+		{"<1.2", []string{"1.1.9"}, []string{"1.2.0"}},
+		{"1.x || >=3.0.0", []string{"1.5.0", "3.1.0"}, []string{"2.0.0"}},
+		{">=1.0.0-beta.2 <1.0.0", []string{"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1"}, []string{"1.0.0-beta.1", "1.0.1-rc.1", "1.0.0"}},
+		{"^1.0.0-rc.1", []string{"1.0.0-rc.1", "1.0.0-rc.2", "1.0.0", "1.5.0"}, []string{"1.1.0-rc.1", "1.0.0-beta"}},
+	}
+
+	for _, d := range data {
+		cons, err := NewConstraint(d.constraint)
+		c.Assert(err, IsNil, Commentf("%s", d.constraint))
+		for _, vs := range d.matches {
+			v, err := NewVersion(vs)
+			c.Assert(err, IsNil)
+			c.Check(cons.Check(v), Equals, true, Commentf("Expected %s to satisfy %s", v, cons))
+		}
+		for _, vs := range d.notMatches {
+			v, err := NewVersion(vs)
+			c.Assert(err, IsNil)
+			c.Check(cons.Check(v), Equals, false, Commentf("Expected %s not to satisfy %s", v, cons))
+		}
+	}
+}
+
+func (*K) TestBad(c *C) {
+	for _, s := range []string{"", " ", "||", "1.x ||", "abc", "1.2.3.4", "01.2", "1.x.2", "=>1.2.3",
+		"!1.2.3", ">*", "<x", "1.2.3 - 2.0.0", ">=", "1.2-beta"} {
+		_, err := NewConstraint(s)
+		c.Check(err, Not(IsNil), Commentf("%q", s))
+	}
+}
+
+func (*K) TestHighest(c *C) {
+	var versions []*Version
+	for _, vs := range []string{"0.9.0", "1.2.0", "1.4.1", "1.3.0", "2.0.0", "1.5.0-rc.1"} {
+		v, err := NewVersion(vs)
+		c.Assert(err, IsNil)
+		versions = append(versions, v)
+	}
+
+	cons, err := NewConstraint("^1.2")
+	c.Assert(err, IsNil)
+	c.Check(cons.Highest(versions).String(), Equals, "1.4.1")
+
+	cons, err = NewConstraint(">=1.5.0-rc.1 <2.0.0")
+	c.Assert(err, IsNil)
+	c.Check(cons.Highest(versions).String(), Equals, "1.5.0-rc.1")
+
+	cons, err = NewConstraint(">=3")
+	c.Assert(err, IsNil)
+	c.Check(cons.Highest(versions), IsNil)
+}
+
+func (*K) TestJSON(c *C) {
+	cons, err := NewConstraint(">= 1.2.0   <2.0.0")
+	c.Assert(err, IsNil)
+	c.Check(cons.String(), Equals, ">=1.2.0 <2.0.0")
+
+	b, err := json.Marshal(cons)
+	c.Assert(err, IsNil)
+	var s string
+	c.Assert(json.Unmarshal(b, &s), IsNil)
+	c.Check(s, Equals, ">=1.2.0 <2.0.0")
+
+	cons2 := new(Constraint)
+	c.Check(json.Unmarshal(b, cons2), IsNil)
+	c.Check(cons2, DeepEquals, cons)
+	c.Check(json.Unmarshal([]byte(`"1.2.3.4"`), cons2), Not(IsNil))
+}
@@ -1,2 +1,5 @@
 // Package nut provides API for managing versioned Go source code packages, called "nuts".
 package nut
+
+// Version of nut library and tool.
+const NutVersion = "0.3.0"
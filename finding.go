@@ -0,0 +1,148 @@
+package nut
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Describes severity of check finding.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"   // nut can't be packed, published or installed
+	SeverityWarning Severity = "warning" // finding is reported only
+	SeverityOff     Severity = "off"     // rule is disabled
+)
+
+// Stable codes of check rules.
+const (
+	RuleVersion           = "version"             // spec version is valid
+	RuleVendor            = "vendor"              // spec vendor is valid
+	RuleAuthors           = "authors"             // authors are given and real
+	RuleLicense           = "license"             // license file is included in ExtraFiles
+	RuleExtraFiles        = "extra-files"         // ExtraFiles entries are valid
+	RuleHomepage          = "homepage"            // homepage is absolute http(s) URL
+	RuleCommand           = "command"             // Command is valid and set only for binary nut
+	RuleDependency        = "dependency"          // dependency constraints are valid
+	RuleRules             = "rules"               // Rules in spec are valid
+	RuleUnusedDependency  = "unused-dependency"   // dependencies are imported
+	RulePackageName       = "package-name"        // package names are valid
+	RulePackageDoc        = "package-doc"         // package summary is in standard form
+	RuleLocalImport       = "local-import"        // local imports refer to packages in nut
+	RuleMissingExtraFiles = "missing-extra-files" // files from ExtraFiles are in nut
+	RuleMissingEmbed      = "missing-embed"       // files matched by //go:embed are in nut
+	RuleChecker           = "checker"             // registered checkers work
+)
+
+// Maps rule codes to severities. SeverityOff disables rule.
+type Rules map[string]Severity
+
+// Default severities of all known rules.
+var DefaultRules = Rules{
+	RuleVersion:           SeverityError,
+	RuleVendor:            SeverityError,
+	RuleAuthors:           SeverityError,
+	RuleLicense:           SeverityError,
+	RuleExtraFiles:        SeverityError,
+	RuleHomepage:          SeverityError,
+	RuleCommand:           SeverityError,
+	RuleDependency:        SeverityError,
+	RuleRules:             SeverityError,
+	RuleUnusedDependency:  SeverityError,
+	RulePackageName:       SeverityError,
+	RulePackageDoc:        SeverityError,
+	RuleLocalImport:       SeverityError,
+	RuleMissingExtraFiles: SeverityError,
+	RuleMissingEmbed:      SeverityError,
+	RuleChecker:           SeverityError,
+}
+
+// Describes single problem found by check.
+type Finding struct {
+	Rule     string   // rule code, see Rule* constants
+	Severity Severity // SeverityError or SeverityWarning
+	Field    string   `json:",omitempty"` // spec field, if finding is about spec
+	File     string   `json:",omitempty"` // slash-separated file or package directory, if finding is about them
+	Message  string
+}
+
+// Returns finding for given rule with default severity (see DefaultRules) and message formatted with fmt.Sprintf.
+func NewFinding(rule, field, file, format string, args ...interface{}) Finding {
+	return Finding{Rule: rule, Severity: DefaultRules[rule], Field: field, File: file, Message: fmt.Sprintf(format, args...)}
+}
+
+// Returns finding message.
+func (f Finding) String() string {
+	return f.Message
+}
+
+// Returns findings with severities overridden by rules; findings of disabled rules are removed.
+// Invalid severities are ignored.
+func (rules Rules) Apply(findings []Finding) (res []Finding) {
+	for _, f := range findings {
+		if s := rules[f.Rule]; s.valid() {
+			f.Severity = s
+		}
+		if f.Severity != SeverityOff {
+			res = append(res, f)
+		}
+	}
+	return
+}
+
+func (s Severity) valid() bool {
+	return s == SeverityError || s == SeverityWarning || s == SeverityOff
+}
+
+// Orders severities: off < warning < error.
+var severityRank = map[Severity]int{SeverityOff: 1, SeverityWarning: 2, SeverityError: 3}
+
+// Returns rules which raise severities compared to DefaultRules.
+func (rules Rules) stricter() Rules {
+	res := make(Rules)
+	for code, s := range rules {
+		if d, ok := DefaultRules[code]; ok && severityRank[s] > severityRank[d] {
+			res[code] = s
+		}
+	}
+	return res
+}
+
+// Checks that rules have known codes and valid severities, and returns findings for problems.
+func (rules Rules) Findings() (findings []Finding) {
+	codes := make([]string, 0, len(rules))
+	for code := range rules {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		if _, ok := DefaultRules[code]; !ok {
+			findings = append(findings, NewFinding(RuleRules, "Rules", "", "Unknown rule %q in Rules.", code))
+			continue
+		}
+		if !rules[code].valid() {
+			findings = append(findings, NewFinding(RuleRules, "Rules", "", "Rule %q has invalid severity %q (should be %q, %q or %q).",
+				code, rules[code], SeverityError, SeverityWarning, SeverityOff))
+		}
+	}
+	return
+}
+
+// Returns findings rendered as strings.
+func FindingStrings(findings []Finding) (res []string) {
+	for _, f := range findings {
+		res = append(res, f.String())
+	}
+	return
+}
+
+// Returns findings with given severity.
+func FilterFindings(findings []Finding, severity Severity) (res []Finding) {
+	for _, f := range findings {
+		if f.Severity == severity {
+			res = append(res, f)
+		}
+	}
+	return
+}
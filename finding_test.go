@@ -0,0 +1,79 @@
+package nut_test
+
+import (
+	"go/build"
+
+	. "."
+	. "launchpad.net/gocheck"
+)
+
+type F struct{}
+
+var _ = Suite(&F{})
+
+func (*F) TestSpecFindings(c *C) {
+	spec := &Spec{Vendor: "debug", Version: Version{Minor: 1}, ExtraFiles: []string{"LICENSE", "../x"}}
+	c.Check(spec.Findings(), DeepEquals, []Finding{
+		{Rule: RuleAuthors, Severity: SeverityError, Field: "Authors", Message: "No authors given."},
+		{Rule: RuleExtraFiles, Severity: SeverityError, Field: "ExtraFiles", File: "../x", Message: `File name "../x" points outside of nut.`},
+	})
+	c.Check(spec.Check(), DeepEquals, []string{"No authors given.", `File name "../x" points outside of nut.`})
+
+	spec.Rules = Rules{RuleAuthors: SeverityOff, RuleExtraFiles: SeverityWarning, "no-such-rule": SeverityOff, RuleHomepage: "fatal"}
+	c.Check(spec.Findings(), DeepEquals, []Finding{
+		{Rule: RuleExtraFiles, Severity: SeverityWarning, Field: "ExtraFiles", File: "../x", Message: `File name "../x" points outside of nut.`},
+		{Rule: RuleRules, Severity: SeverityError, Field: "Rules", Message: `Rule "homepage" has invalid severity "fatal" (should be "error", "warning" or "off").`},
+		{Rule: RuleRules, Severity: SeverityError, Field: "Rules", Message: `Unknown rule "no-such-rule" in Rules.`},
+	})
+}
+
+func (*F) TestNutFindings(c *C) {
+	nut := &Nut{
+		Spec:    Spec{Vendor: "debug", Version: Version{Minor: 1}, Authors: []Person{{FullName: "Alexey Palazhchenko"}}, ExtraFiles: []string{"LICENSE"}},
+		Package: build.Package{Name: "a", Doc: "Package a is used to test nut."},
+		Subpackages: map[string]*build.Package{
+			"sub": {Name: "sub", Imports: []string{"../missing"}},
+		},
+	}
+	findings := nut.Findings()
+	c.Check(findings, DeepEquals, []Finding{
+		{Rule: RulePackageDoc, Severity: SeverityError, File: "sub", Message: `sub: Package summary in code should be in form "Package sub ... ."`},
+		{Rule: RuleLocalImport, Severity: SeverityError, File: "sub", Message: `Local import "../missing" in sub doesn't refer to package in nut.`},
+	})
+	c.Check(FilterFindings(findings, SeverityError), DeepEquals, findings)
+	c.Check(FilterFindings(findings, SeverityWarning), HasLen, 0)
+
+	nut.Rules = Rules{RulePackageDoc: SeverityWarning, RuleLocalImport: SeverityOff}
+	findings = nut.Findings()
+	c.Check(findings, DeepEquals, []Finding{
+		{Rule: RulePackageDoc, Severity: SeverityWarning, File: "sub", Message: `sub: Package summary in code should be in form "Package sub ... ."`},
+	})
+	c.Check(FindingStrings(FilterFindings(findings, SeverityWarning)), DeepEquals, []string{`sub: Package summary in code should be in form "Package sub ... ."`})
+	c.Check(Rules{RulePackageDoc: SeverityOff}.Apply(nut.Findings()), HasLen, 0)
+}
+
+func (*F) TestConsumerFindings(c *C) {
+	files := map[string]string{
+		"a.go": "package a\n",
+		"nut.json": `{"Version": "0.0.1", "Vendor": "org",
+			"Rules": {"authors": "off", "license": "off", "package-doc": "off", "org-copyright": "error"}}`,
+	}
+	nf := new(NutFile)
+	_, err := nf.ReadFrom(makeNut(c, files, []string{"a.go", "nut.json"}, nil))
+	c.Assert(err, IsNil)
+	copyright := Finding{Rule: "org-copyright", Severity: SeverityError, File: "a.go", Message: "No copyright header in a.go."}
+	c.Check(nf.Findings(), DeepEquals, []Finding{copyright})
+
+	// nut's own rules may only raise severities
+	authors := Finding{Rule: RuleAuthors, Severity: SeverityError, Field: "Authors", Message: "No authors given."}
+	doc := Finding{Rule: RulePackageDoc, Severity: SeverityError, Message: `Package summary in code should be in form "Package a ... ."`}
+	c.Check(nf.ConsumerFindings(nil), DeepEquals, []Finding{
+		authors,
+		{Rule: RuleLicense, Severity: SeverityError, Field: "ExtraFiles", Message: "Spec should include license file in ExtraFiles."},
+		doc,
+		copyright,
+	})
+
+	copyright.Severity = SeverityWarning
+	c.Check(nf.ConsumerFindings(Rules{RuleLicense: SeverityOff, "org-copyright": SeverityWarning}), DeepEquals, []Finding{authors, doc, copyright})
+}
@@ -0,0 +1,31 @@
+package nut
+
+import (
+	"io/fs"
+)
+
+// check interfaces
+var (
+	_ fs.FS        = &NutFile{}
+	_ fs.ReadDirFS = &NutFile{}
+	_ fs.StatFS    = &NutFile{}
+)
+
+// Opens file or directory in nut. Names are slash-separated and relative to nut root (see fs.ValidPath);
+// directories are implied by file names. Service files (manifest and signature) are included.
+// Implements fs.FS.
+func (nf *NutFile) Open(name string) (fs.File, error) {
+	return nf.Reader.Open(name)
+}
+
+// Returns entries of directory in nut sorted by name.
+// Implements fs.ReadDirFS.
+func (nf *NutFile) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(nf.Reader, name)
+}
+
+// Returns information about file or directory in nut.
+// Implements fs.StatFS.
+func (nf *NutFile) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(nf.Reader, name)
+}
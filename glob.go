@@ -0,0 +1,61 @@
+package nut
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Checks that glob pattern is valid. See MatchGlob for syntax.
+func CheckGlob(pattern string) error {
+	for _, elem := range strings.Split(pattern, "/") {
+		if _, err := path.Match(elem, ""); err != nil {
+			return fmt.Errorf("Pattern %q is invalid: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Reports whether slash-separated name matches glob pattern.
+// Pattern syntax is the same as for path.Match, plus "**" element, which matches
+// zero or more directories: "**/*.md", "docs/**/*.png".
+func MatchGlob(pattern, name string) bool {
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// Returns files matching entry of Spec.ExtraFiles among given files (slash-separated).
+// Entry may be file name, directory name (all files in it are matched recursively)
+// or glob pattern (see MatchGlob); directories matched by pattern are also included recursively.
+func MatchExtraFiles(entry string, files []string) (matched []string) {
+	for _, file := range files {
+		for name := file; name != "."; name = path.Dir(name) {
+			if MatchGlob(entry, name) {
+				matched = append(matched, file)
+				break
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,58 @@
+package nut_test
+
+import (
+	. "."
+	. "launchpad.net/gocheck"
+)
+
+type Gl struct{}
+
+var _ = Suite(&Gl{})
+
+func (*Gl) TestMatchGlob(c *C) {
+	for _, t := range []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"README", "README", true},
+		{"README", "docs/README", false},
+		{"*.md", "README.md", true},
+		{"*.md", "docs/README.md", false},
+		{"docs/*", "docs/a.png", true},
+		{"docs/*", "docs/img/a.png", false},
+		{"**", "docs/img/a.png", true},
+		{"**/*.md", "README.md", true},
+		{"**/*.md", "docs/api/index.md", true},
+		{"**/*.md", "docs/api/index.txt", false},
+		{"docs/**/*.png", "docs/a.png", true},
+		{"docs/**/*.png", "docs/img/x/a.png", true},
+		{"docs/**/*.png", "img/a.png", false},
+		{"docs/**", "docs/img/a.png", true},
+		{"docs/**", "docs", true},
+		{"LICEN[CS]E", "LICENSE", true},
+		{"[", "[", false},
+	} {
+		c.Check(MatchGlob(t.pattern, t.name), Equals, t.match, Commentf("%q %q", t.pattern, t.name))
+	}
+
+	c.Check(CheckGlob("docs/**/*.md"), IsNil)
+	c.Check(CheckGlob("docs/[a-"), ErrorMatches, `Pattern "docs/\[a-" is invalid: syntax error in pattern`)
+}
+
+func (*Gl) TestMatchExtraFiles(c *C) {
+	files := []string{"LICENSE", "README.md", "docs/index.md", "docs/img/a.png", "examples/main.go", "nut.json"}
+	for _, t := range []struct {
+		entry   string
+		matched []string
+	}{
+		{"LICENSE", []string{"LICENSE"}},
+		{"docs", []string{"docs/index.md", "docs/img/a.png"}},
+		{"docs/img/", nil},
+		{"**/*.md", []string{"README.md", "docs/index.md"}},
+		{"*/img", []string{"docs/img/a.png"}},
+		{"e*", []string{"examples/main.go"}},
+		{"missing", nil},
+	} {
+		c.Check(MatchExtraFiles(t.entry, files), DeepEquals, t.matched, Commentf("%q", t.entry))
+	}
+}
@@ -0,0 +1,120 @@
+package nut
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	IgnoreFileName = ".nutignore"
+)
+
+// Describes rules from file .nutignore: files matching them are not packed.
+// Syntax is the same as for .gitignore:
+//   - blank lines and lines starting with "#" are skipped;
+//   - "!" prefix negates rule: matching file is included again;
+//   - pattern ending with "/" matches only directories;
+//   - pattern with "/" at the beginning or in the middle is relative to nut root,
+//     otherwise it matches file or directory name at any level;
+//   - "*", "?", "[...]" and "**" are supported (see MatchGlob).
+//
+// Files in ignored directories can't be included again.
+type IgnoreRules struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// Reads rules from specified file.
+func (ir *IgnoreRules) ReadFile(fileName string) (err error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	_, err = ir.ReadFrom(f)
+	return
+}
+
+// ReadFrom reads rules from r until EOF, adding them to existing ones.
+// The return value n is the number of bytes read.
+// Any error except io.EOF encountered during the read is also returned.
+// Implements io.ReaderFrom.
+func (ir *IgnoreRules) ReadFrom(r io.Reader) (n int64, err error) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		n += int64(len(line)) + 1
+
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:] // escaped "!" or "#"
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		if err = CheckGlob(line); err != nil {
+			return
+		}
+		rule.pattern = line
+		ir.rules = append(ir.rules, rule)
+	}
+	err = s.Err()
+	return
+}
+
+// Reports whether file with given slash-separated name (relative to nut root) is ignored.
+func (ir *IgnoreRules) Ignored(name string) bool {
+	elems := strings.Split(name, "/")
+	for i := 1; i < len(elems); i++ {
+		if ir.match(strings.Join(elems[:i], "/"), true) {
+			return true
+		}
+	}
+	return ir.match(name, false)
+}
+
+// Returns result of the last rule matching name.
+func (ir *IgnoreRules) match(name string, isDir bool) (ignored bool) {
+	for _, rule := range ir.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		var ok bool
+		if rule.anchored {
+			ok = MatchGlob(rule.pattern, name)
+		} else {
+			ok = MatchGlob(rule.pattern, path.Base(name))
+		}
+		if ok {
+			ignored = !rule.negate
+		}
+	}
+	return
+}
@@ -0,0 +1,55 @@
+package nut_test
+
+import (
+	"strings"
+
+	. "."
+	. "launchpad.net/gocheck"
+)
+
+type I struct{}
+
+var _ = Suite(&I{})
+
+func (*I) TestIgnored(c *C) {
+	ir := new(IgnoreRules)
+	_, err := ir.ReadFrom(strings.NewReader(`
+# comment
+*.log
+!keep.log
+build/
+/root.txt
+docs/**/*.tmp
+\#hash
+secret
+!secret/public
+`))
+	c.Assert(err, IsNil)
+
+	for _, t := range []struct {
+		name    string
+		ignored bool
+	}{
+		{"a.go", false},
+		{"debug.log", true},
+		{"sub/debug.log", true},
+		{"keep.log", false},
+		{"sub/keep.log", false},
+		{"build/out.bin", true},
+		{"sub/build/out.bin", true},
+		{"build", false}, // file, not directory
+		{"root.txt", true},
+		{"sub/root.txt", false},
+		{"docs/a.tmp", true},
+		{"docs/x/y/a.tmp", true},
+		{"a.tmp", false},
+		{"#hash", true},
+		{"secret/public", true}, // files in ignored directories can't be included again
+		{"secret", true},
+	} {
+		c.Check(ir.Ignored(t.name), Equals, t.ignored, Commentf("%q", t.name))
+	}
+
+	_, err = new(IgnoreRules).ReadFrom(strings.NewReader("[a-\n"))
+	c.Check(err, ErrorMatches, `Pattern "\[a-" is invalid: syntax error in pattern`)
+}
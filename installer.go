@@ -0,0 +1,545 @@
+package nut
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Returned by Registry.Versions if registry doesn't list versions of nuts.
+var ErrVersionsNotListed = errors.New("Registry doesn't list versions.")
+
+// Describes source of nuts for Installer.
+type Registry interface {
+	// Returns URL of nut with given identifier (import path or URL, without version)
+	// and default install prefix for it.
+	Resolve(id string) (u *url.URL, prefix string, err error)
+
+	// Returns available versions of nut at URL (without version).
+	// Returns ErrVersionsNotListed (possibly wrapped) if registry doesn't list versions.
+	Versions(u *url.URL) ([]*Version, error)
+
+	// Returns reader of .nut file at URL. Installer closes it.
+	Download(u *url.URL) (io.ReadCloser, error)
+}
+
+// Describes installation of nuts into workspace: nuts are downloaded from registry
+// (with dependencies, see Resolver), checked, written into <Workspace>/nut/<prefix>,
+// unpacked into <Workspace>/src/<prefix>/<vendor>/<name> with imports rewritten (see Unpack)
+// and installed with 'go install'. Nothing is written until versions of all nuts are selected.
+type Installer struct {
+	Workspace string   // workspace directory (GOPATH entry)
+	Prefix    string   // install prefix; if empty, default prefix from Registry.Resolve is used
+	Registry  Registry // source of nuts for Get
+	Lock      *Lock    // if not nil, only locked versions are installed, and nuts are checked against lock
+
+	// Returns import paths of nuts among imports of nut (see Resolver).
+	// If nil, dependencies are not installed.
+	NutImports func(imports []string) []string
+
+	TrustedKeys   []ed25519.PublicKey // keys of trusted nut signers
+	RequireSigned bool                // refuse unsigned nuts and nuts signed with untrusted keys
+	NoCheck       bool                // do not check nuts for errors with NutFile.Findings (not recommended)
+	Rules         Rules               // overrides severities of check rules; nut's own Spec.Rules may only raise them
+	NoBuild       bool                // do not run 'go install'
+
+	// If not nil, called to report progress.
+	Logf func(format string, v ...interface{})
+
+	downloaded map[string]*downloadedNut // "<id> <version>" => downloaded nut
+}
+
+// Describes nut downloaded into temporary file.
+type downloadedNut struct {
+	nf   *NutFile
+	path string // path of temporary file
+	hash string // hex-encoded SHA-256 of .nut file
+	url  string // URL of that exact version
+}
+
+// Closes and removes temporary file.
+func (d *downloadedNut) remove() {
+	if d.nf != nil {
+		d.nf.Close()
+	}
+	os.Remove(d.path)
+}
+
+// Describes nut installed by Installer.
+type InstalledNut struct {
+	ID         string // nut identifier: import path or URL
+	Vendor     string
+	Name       string
+	Version    Version
+	Prefix     string // install prefix
+	URL        string // URL nut was downloaded from, empty for Installer.InstallFile
+	ImportPath string // import path of nut in workspace: <prefix>/<vendor>/<name>
+	NutPath    string // path of .nut file in workspace
+	Dir        string // path of source directory in workspace
+	Command    string // path of installed command for binary nut, empty otherwise
+}
+
+// Describes result of installation.
+type InstallResult struct {
+	Nuts []InstalledNut // sorted by identifier
+	Lock *Lock          // lock with exact versions of installed nuts (for Installer.Get)
+}
+
+// Returns true if URL requests specific nut version, false if it requests the latest one.
+func VersionRequested(u *url.URL) bool {
+	p := strings.Split(strings.TrimSuffix(u.Path, "/"), "/")
+	last := p[len(p)-1]
+	if strings.HasSuffix(last, ".nut") {
+		return true
+	}
+	_, err := NewVersion(last)
+	return err == nil
+}
+
+// Returns vendor, name and version of nut requested by URL.
+// Vendor is empty and version is nil if URL does not contain them.
+func RequestedNut(u *url.URL) (vendor, name string, version *Version) {
+	p := strings.Split(strings.TrimSuffix(u.Path, "/"), "/")
+
+	// .../<vendor>/<name>-<version>.nut
+	last := p[len(p)-1]
+	if strings.HasSuffix(last, ".nut") {
+		parts := strings.SplitN(strings.TrimSuffix(last, ".nut"), "-", 2)
+		name = parts[0]
+		if len(parts) == 2 {
+			version, _ = NewVersion(parts[1])
+		}
+		return
+	}
+
+	// .../<vendor>/<name>[/<version>]
+	if VersionRequested(u) {
+		version, _ = NewVersion(last)
+		p = p[:len(p)-1]
+	}
+	if len(p) > 0 {
+		name = p[len(p)-1]
+	}
+	if len(p) > 1 {
+		vendor = p[len(p)-2]
+	}
+	return
+}
+
+func (in *Installer) logf(format string, v ...interface{}) {
+	if in.Logf != nil {
+		in.Logf(format, v...)
+	}
+}
+
+func (in *Installer) init() {
+	if in.downloaded == nil {
+		in.downloaded = make(map[string]*downloadedNut)
+	}
+}
+
+// Removes downloaded temporary files.
+func (in *Installer) cleanup() {
+	for _, d := range in.downloaded {
+		d.remove()
+	}
+	in.downloaded = nil
+}
+
+// Returns available versions of nut with given identifier.
+// If Lock is set, only locked version is returned.
+// If registry doesn't list versions (see ErrVersionsNotListed) or lists none, the latest version is downloaded.
+func (in *Installer) Versions(id string) (versions []*Version, err error) {
+	in.init()
+	if in.Lock != nil {
+		ln := in.Lock.Find(id)
+		if ln == nil {
+			err = fmt.Errorf("%s is not found in %s.", id, LockFileName)
+			return
+		}
+		versions = []*Version{&ln.Version}
+		return
+	}
+
+	u, _, err := in.Registry.Resolve(id)
+	if err != nil {
+		return
+	}
+	if !strings.HasSuffix(u.Path, ".nut") {
+		versions, err = in.Registry.Versions(u)
+		if (err == nil && len(versions) != 0) || (err != nil && !errors.Is(err, ErrVersionsNotListed)) {
+			return
+		}
+
+		// registry may not list versions, fallback to the latest one
+		if err == nil {
+			in.logf("No versions listed at %s.", u)
+		} else {
+			in.logf("%s", err)
+		}
+	}
+
+	d, err := in.fetch(u)
+	if err != nil {
+		return
+	}
+
+	// remember URL of that exact version
+	if !VersionRequested(u) {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + d.nf.Version.String()
+	}
+	d.url = u.String()
+	in.add(id, d)
+	versions = []*Version{&d.nf.Version}
+	return
+}
+
+// Returns nut with given identifier and version, downloading it if needed.
+func (in *Installer) get(id string, version *Version) (nf *NutFile, err error) {
+	if d := in.downloaded[id+" "+version.String()]; d != nil {
+		nf = d.nf
+		return
+	}
+
+	var u *url.URL
+	var ln *LockedNut
+	if in.Lock != nil {
+		ln = in.Lock.Find(id)
+		if ln == nil || ln.Version.String() != version.String() {
+			err = fmt.Errorf("%s %s is not found in %s.", id, version, LockFileName)
+			return
+		}
+		u, err = url.Parse(ln.URL)
+	} else {
+		u, _, err = in.Registry.Resolve(id)
+		if err == nil {
+			u.Path = strings.TrimSuffix(u.Path, "/") + "/" + version.String()
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	d, err := in.fetch(u)
+	if err != nil {
+		return
+	}
+	if ln != nil {
+		err = ln.VerifyHash(d.nf, d.hash)
+		if err != nil {
+			d.remove()
+			return
+		}
+	}
+	d.url = u.String()
+	in.add(id, d)
+	nf = d.nf
+	return
+}
+
+// Remembers downloaded nut.
+func (in *Installer) add(id string, d *downloadedNut) {
+	key := id + " " + d.nf.Version.String()
+	if old := in.downloaded[key]; old != nil {
+		old.remove()
+	}
+	in.downloaded[key] = d
+}
+
+// Downloads nut into temporary file while hashing it, checks that it matches request and checks it.
+func (in *Installer) fetch(u *url.URL) (d *downloadedNut, err error) {
+	rc, err := in.Registry.Download(u)
+	if err != nil {
+		return
+	}
+	defer rc.Close()
+
+	f, err := ioutil.TempFile("", "nut-")
+	if err != nil {
+		return
+	}
+	d = &downloadedNut{path: f.Name()}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(rc, MaxNutSize+1))
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil && n > MaxNutSize {
+		err = fmt.Errorf("Nut is too big: more than %d bytes.", MaxNutSize)
+	}
+	if err == nil {
+		d.hash = hex.EncodeToString(h.Sum(nil))
+		d.nf = new(NutFile)
+		err = d.nf.OpenFile(d.path)
+		if err != nil {
+			d.nf = nil
+		}
+	}
+	if err == nil {
+		vendor, name, version := RequestedNut(u)
+		err = d.nf.CheckIdentity(vendor, name, version)
+	}
+	if err == nil {
+		err = in.check(d.nf)
+	}
+	if err != nil {
+		d.remove()
+		d = nil
+		err = fmt.Errorf("%s: %s", u, err)
+	}
+	return
+}
+
+// Checks signature of nut and checks nut for errors (unless NoCheck is set).
+func (in *Installer) check(nf *NutFile) error {
+	err := nf.VerifySignature(in.TrustedKeys)
+	if !in.RequireSigned && (err == ErrNotSigned || err == ErrUntrusted) {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !in.NoCheck {
+		findings := nf.ConsumerFindings(in.Rules)
+		for _, f := range FilterFindings(findings, SeverityWarning) {
+			in.logf("Warning: %s", f)
+		}
+		errors := FindingStrings(FilterFindings(findings, SeverityError))
+		if len(errors) != 0 {
+			return fmt.Errorf("Found errors:\n    %s\nPlease contact nut author.", strings.Join(errors, "\n    "))
+		}
+	}
+	return nil
+}
+
+// Returns install prefix for nut with given identifier.
+func (in *Installer) prefix(id string) (prefix string, err error) {
+	if in.Prefix != "" {
+		prefix = in.Prefix
+		return
+	}
+	_, prefix, err = in.Registry.Resolve(id)
+	return
+}
+
+// Downloads nuts with given identifiers (import paths or URLs) and version constraints (nil for any version)
+// with all dependencies, and installs them.
+// Downloaded nuts are kept in temporary files, which are removed before return.
+func (in *Installer) Get(roots map[string]*Constraint) (res *InstallResult, err error) {
+	in.init()
+	defer in.cleanup()
+
+	// select versions of all nuts before writing anything
+	nutImports := in.NutImports
+	if nutImports == nil {
+		nutImports = func([]string) []string { return nil }
+	}
+	resolver := &Resolver{Versions: in.Versions, Get: in.get, NutImports: nutImports}
+	nuts, err := resolver.Resolve(roots)
+	if err != nil {
+		return
+	}
+
+	ids := make([]string, 0, len(nuts))
+	for id := range nuts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	// check that nuts do not overwrite each other
+	res = &InstallResult{Lock: new(Lock)}
+	pathsToIds := make(map[string]string, len(ids))
+	for _, id := range ids {
+		nf := nuts[id]
+		in.logf("Selected %s %s.", id, nf.Version)
+
+		var prefix string
+		prefix, err = in.prefix(id)
+		if err != nil {
+			return
+		}
+		path := nf.ImportPath(prefix)
+		if other, ok := pathsToIds[path]; ok {
+			err = fmt.Errorf("Both %s and %s should be installed into %s.", other, id, path)
+			return
+		}
+		pathsToIds[path] = id
+
+		d := in.downloaded[id+" "+nf.Version.String()]
+		inut := in.installed(id, prefix, filepath.Join(prefix, nf.FileName()), nf)
+		inut.URL = d.url
+		res.Nuts = append(res.Nuts, inut)
+		res.Lock.Add(NewLockedNutHash(id, d.url, nf, d.hash))
+	}
+
+	// write and unpack
+	for i, id := range ids {
+		err = in.write(&res.Nuts[i], nuts[id], in.downloaded[id+" "+nuts[id].Version.String()].path)
+		if err != nil {
+			return
+		}
+	}
+
+	// install in lexical order
+	err = in.build(res.Nuts, nuts)
+	return
+}
+
+// Installs nut from specified .nut file. Prefix should be set.
+func (in *Installer) InstallFile(fileName string) (res *InstallResult, err error) {
+	if in.Prefix == "" {
+		err = fmt.Errorf("Install prefix is not set.")
+		return
+	}
+
+	nf := new(NutFile)
+	err = nf.OpenFile(fileName)
+	if err != nil {
+		return
+	}
+	defer nf.Close()
+
+	// vendor and name are used in paths, so they are checked regardless of NoCheck and Rules
+	err = nf.CheckIdentity("", "", nil)
+	if err == nil {
+		err = in.check(nf)
+	}
+	if err != nil {
+		return
+	}
+
+	inut := in.installed(nf.ImportPath(in.Prefix), in.Prefix, nf.FilePath(in.Prefix), nf)
+	err = in.write(&inut, nf, fileName)
+	if err != nil {
+		return
+	}
+	res = &InstallResult{Nuts: []InstalledNut{inut}}
+	err = in.build(res.Nuts, map[string]*NutFile{inut.ID: nf})
+	return
+}
+
+// Returns description of nut to be installed; nutPath is relative to <Workspace>/nut.
+func (in *Installer) installed(id, prefix, nutPath string, nf *NutFile) InstalledNut {
+	path := nf.ImportPath(prefix)
+	inut := InstalledNut{
+		ID:         id,
+		Vendor:     nf.Vendor,
+		Name:       nf.NutName(),
+		Version:    nf.Version,
+		Prefix:     prefix,
+		ImportPath: path,
+		NutPath:    filepath.Join(in.Workspace, "nut", nutPath),
+		Dir:        filepath.Join(in.Workspace, "src", filepath.FromSlash(path)),
+	}
+	if nf.IsCommand() && !in.NoBuild {
+		inut.Command = in.commandPath(nf.NutName())
+	}
+	return inut
+}
+
+// Copies .nut file into workspace and unpacks it.
+func (in *Installer) write(inut *InstalledNut, nf *NutFile, fileName string) (err error) {
+	in.logf("Writing %s ...", inut.NutPath)
+	err = os.MkdirAll(filepath.Dir(inut.NutPath), unpackDirPerm)
+	if err == nil {
+		err = copyFile(inut.NutPath, fileName)
+	}
+	if err != nil {
+		return
+	}
+
+	in.logf("Unpacking into %s ...", inut.Dir)
+	return Unpack(nf, inut.Dir, &UnpackOptions{Prefix: inut.Prefix, RemoveDir: true, Logf: in.Logf})
+}
+
+// Copies file src to dst, overwriting it.
+func copyFile(dst, src string) (err error) {
+	s, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+
+	d, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(d, s)
+	if e := d.Close(); err == nil {
+		err = e
+	}
+	return
+}
+
+// Runs 'go install' for all packages in installed nuts.
+func (in *Installer) build(installed []InstalledNut, nuts map[string]*NutFile) error {
+	if in.NoBuild {
+		return nil
+	}
+
+	var patterns []string
+	for _, inut := range installed {
+		pattern := inut.ImportPath
+		if len(nuts[inut.ID].Subpackages) != 0 {
+			pattern += "/..."
+		}
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		args := []string{"install"}
+		if in.Logf != nil {
+			args = append(args, "-v")
+		}
+		c := exec.Command("go", append(args, pattern)...)
+		c.Env = append(os.Environ(), "GOPATH="+in.gopath())
+		in.logf("Running %q", strings.Join(c.Args, " "))
+		out, err := c.CombinedOutput()
+		if len(out) != 0 {
+			in.logf("%s", out)
+		}
+		if err != nil {
+			return fmt.Errorf("%q failed: %s\n%s", strings.Join(c.Args, " "), err, out)
+		}
+	}
+	return nil
+}
+
+// Returns GOPATH for 'go install': workspace followed by current GOPATH.
+func (in *Installer) gopath() string {
+	gopath := os.Getenv("GOPATH")
+	for _, p := range filepath.SplitList(gopath) {
+		if filepath.Clean(p) == filepath.Clean(in.Workspace) {
+			return gopath
+		}
+	}
+	if gopath == "" {
+		return in.Workspace
+	}
+	return in.Workspace + string(filepath.ListSeparator) + gopath
+}
+
+// Returns path of command installed by 'go install'.
+func (in *Installer) commandPath(name string) string {
+	dir := os.Getenv("GOBIN")
+	if dir == "" {
+		dir = filepath.Join(in.Workspace, "bin")
+	}
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(dir, name)
+}
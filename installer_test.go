@@ -0,0 +1,267 @@
+package nut_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "."
+	. "launchpad.net/gocheck"
+)
+
+type In struct {
+	nuts        map[string][]byte // URL path => nut file
+	downloads   []string
+	versionsErr error // returned by Versions if not nil
+}
+
+var _ = Suite(&In{})
+
+func (in *In) SetUpTest(c *C) {
+	in.nuts = make(map[string][]byte)
+	in.downloads = nil
+	in.versionsErr = nil
+}
+
+// Packs nut with given name, version and imports and adds it to registry.
+func (in *In) add(c *C, name, version string, imports ...string) []byte {
+	src := fmt.Sprintf("// Package %s is used to test nut.\npackage %s\n", name, name)
+	if len(imports) != 0 {
+		src += fmt.Sprintf("\nimport (\n\t_ %q\n)\n", strings.Join(imports, "\"\n\t_ \""))
+	}
+
+	buf := new(bytes.Buffer)
+	nw := NewNutWriter(buf)
+	c.Assert(nw.Add(name+".go", []byte(src)), IsNil)
+	c.Assert(nw.Add("LICENSE", []byte("license")), IsNil)
+	spec := fmt.Sprintf(`{"Version": %q, "Vendor": "debug", "Authors": [{"FullName": "Alexey Palazhchenko"}], "ExtraFiles": ["LICENSE"]}`, version)
+	c.Assert(nw.Add(SpecFileName, []byte(spec)), IsNil)
+	c.Assert(nw.Close(), IsNil)
+
+	in.nuts["/debug/"+name+"/"+version] = buf.Bytes()
+	return buf.Bytes()
+}
+
+func (in *In) Resolve(id string) (u *url.URL, prefix string, err error) {
+	if !strings.HasPrefix(id, "gonuts.io/") {
+		err = fmt.Errorf("%s is not a nut", id)
+		return
+	}
+	u, err = url.Parse("http://example.com" + strings.TrimPrefix(id, "gonuts.io"))
+	prefix = "gonuts.io"
+	return
+}
+
+func (in *In) Versions(u *url.URL) (versions []*Version, err error) {
+	if in.versionsErr != nil {
+		err = in.versionsErr
+		return
+	}
+	for p := range in.nuts {
+		if strings.HasPrefix(p, u.Path+"/") {
+			var v *Version
+			v, err = NewVersion(p[len(u.Path)+1:])
+			if err != nil {
+				return
+			}
+			versions = append(versions, v)
+		}
+	}
+	return
+}
+
+func (in *In) Download(u *url.URL) (io.ReadCloser, error) {
+	in.downloads = append(in.downloads, u.Path)
+	b, ok := in.nuts[u.Path]
+	if !ok {
+		return nil, fmt.Errorf("%s: not found", u)
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (in *In) installer(c *C) *Installer {
+	return &Installer{
+		Workspace: c.MkDir(),
+		Registry:  in,
+		NoBuild:   true,
+		NutImports: func(imports []string) (nuts []string) {
+			for _, imp := range imports {
+				if strings.HasPrefix(imp, "gonuts.io/") {
+					nuts = append(nuts, imp)
+				}
+			}
+			return
+		},
+	}
+}
+
+func (in *In) TestGet(c *C) {
+	in.add(c, "util", "0.1.0")
+	in.add(c, "util", "0.2.0")
+	in.add(c, "lib", "0.1.0", "gonuts.io/debug/util")
+
+	i := in.installer(c)
+	i.Prefix = "example.com"
+	res, err := i.Get(map[string]*Constraint{"gonuts.io/debug/lib": nil})
+	c.Assert(err, IsNil)
+	c.Check(in.downloads, DeepEquals, []string{"/debug/lib/0.1.0", "/debug/util/0.2.0"})
+
+	c.Assert(res.Nuts, HasLen, 2)
+	expected := []InstalledNut{
+		{
+			ID:         "gonuts.io/debug/lib",
+			Vendor:     "debug",
+			Name:       "lib",
+			Version:    Version{Minor: 1},
+			Prefix:     "example.com",
+			URL:        "http://example.com/debug/lib/0.1.0",
+			ImportPath: "example.com/debug/lib",
+			NutPath:    filepath.Join(i.Workspace, "nut", "example.com", "lib-0.1.0.nut"),
+			Dir:        filepath.Join(i.Workspace, "src", "example.com", "debug", "lib"),
+		},
+		{
+			ID:         "gonuts.io/debug/util",
+			Vendor:     "debug",
+			Name:       "util",
+			Version:    Version{Minor: 2},
+			Prefix:     "example.com",
+			URL:        "http://example.com/debug/util/0.2.0",
+			ImportPath: "example.com/debug/util",
+			NutPath:    filepath.Join(i.Workspace, "nut", "example.com", "util-0.2.0.nut"),
+			Dir:        filepath.Join(i.Workspace, "src", "example.com", "debug", "util"),
+		},
+	}
+	c.Check(res.Nuts, DeepEquals, expected)
+
+	// nuts are written and unpacked
+	for _, inut := range res.Nuts {
+		b, err := ioutil.ReadFile(inut.NutPath)
+		c.Check(err, IsNil)
+		c.Check(b, DeepEquals, in.nuts["/debug/"+inut.Name+"/"+inut.Version.String()])
+	}
+	for _, inut := range res.Nuts {
+		_, err = os.Stat(filepath.Join(inut.Dir, inut.Name+".go"))
+		c.Check(err, IsNil)
+	}
+
+	// lock
+	c.Assert(res.Lock.Nuts, HasLen, 2)
+	c.Check(res.Lock.Find("gonuts.io/debug/util").URL, Equals, "http://example.com/debug/util/0.2.0")
+
+	// the same versions are installed with lock, even if newer are available
+	in.add(c, "util", "0.3.0")
+	in.downloads = nil
+	i = in.installer(c)
+	i.Lock = res.Lock
+	res, err = i.Get(map[string]*Constraint{"gonuts.io/debug/lib": nil})
+	c.Assert(err, IsNil)
+	c.Check(in.downloads, DeepEquals, []string{"/debug/lib/0.1.0", "/debug/util/0.2.0"})
+	c.Check(res.Nuts[0].Prefix, Equals, "gonuts.io")
+	c.Check(res.Nuts[1].Version.String(), Equals, "0.2.0")
+
+	// changed nut doesn't match lock
+	in.nuts["/debug/util/0.2.0"] = in.nuts["/debug/util/0.3.0"]
+	i = in.installer(c)
+	i.Lock = res.Lock
+	_, err = i.Get(map[string]*Constraint{"gonuts.io/debug/lib": nil})
+	c.Check(err, NotNil)
+}
+
+func (in *In) TestVersionsNotListed(c *C) {
+	// registry lists no versions and serves the latest nut without version
+	in.nuts["/debug/util"] = in.add(c, "util", "0.1.0")
+	delete(in.nuts, "/debug/util/0.1.0")
+
+	i := in.installer(c)
+	versions, err := i.Versions("gonuts.io/debug/util")
+	c.Assert(err, IsNil)
+	c.Check(versions, DeepEquals, []*Version{{Minor: 1}})
+	c.Check(in.downloads, DeepEquals, []string{"/debug/util"})
+
+	in.downloads = nil
+	i = in.installer(c)
+	i.Prefix = "example.com"
+	res, err := i.Get(map[string]*Constraint{"gonuts.io/debug/util": nil})
+	c.Assert(err, IsNil)
+	c.Assert(res.Nuts, HasLen, 1)
+	c.Check(res.Nuts[0].URL, Equals, "http://example.com/debug/util/0.1.0")
+	c.Check(in.downloads, DeepEquals, []string{"/debug/util"})
+
+	in.downloads = nil
+	in.versionsErr = fmt.Errorf("http://example.com/debug/util: status code 404 (%w)", ErrVersionsNotListed)
+	versions, err = in.installer(c).Versions("gonuts.io/debug/util")
+	c.Assert(err, IsNil)
+	c.Check(versions, DeepEquals, []*Version{{Minor: 1}})
+	c.Check(in.downloads, DeepEquals, []string{"/debug/util"})
+
+	// other errors are not ignored
+	in.downloads = nil
+	in.versionsErr = fmt.Errorf("http://example.com/debug/util: Invalid token.")
+	_, err = in.installer(c).Versions("gonuts.io/debug/util")
+	c.Check(err, Equals, in.versionsErr)
+	c.Check(in.downloads, HasLen, 0)
+}
+
+func (in *In) TestGetErrors(c *C) {
+	in.add(c, "lib", "0.1.0")
+
+	i := in.installer(c)
+	_, err := i.Get(map[string]*Constraint{"gonuts.io/debug/nope": nil})
+	c.Check(err, NotNil)
+
+	i = in.installer(c)
+	i.RequireSigned = true
+	_, err = i.Get(map[string]*Constraint{"gonuts.io/debug/lib": nil})
+	c.Check(err, ErrorMatches, `http://example.com/debug/lib/0.1.0: .*`)
+
+	i = in.installer(c)
+	i.Lock = new(Lock)
+	_, err = i.Get(map[string]*Constraint{"gonuts.io/debug/lib": nil})
+	c.Check(err, ErrorMatches, `gonuts.io/debug/lib is not found in nut.lock.`)
+
+	// nothing is written
+	fis, err := ioutil.ReadDir(i.Workspace)
+	c.Assert(err, IsNil)
+	c.Check(fis, HasLen, 0)
+}
+
+func (in *In) TestInstallFile(c *C) {
+	fileName := filepath.Join(c.MkDir(), "util-0.1.0.nut")
+	c.Assert(ioutil.WriteFile(fileName, in.add(c, "util", "0.1.0"), 0644), IsNil)
+
+	i := in.installer(c)
+	_, err := i.InstallFile(fileName)
+	c.Check(err, ErrorMatches, `Install prefix is not set.`)
+
+	i.Prefix = "localhost"
+	res, err := i.InstallFile(fileName)
+	c.Assert(err, IsNil)
+	c.Assert(res.Nuts, HasLen, 1)
+	c.Check(res.Nuts[0].ID, Equals, "localhost/debug/util")
+	c.Check(res.Nuts[0].NutPath, Equals, filepath.Join(i.Workspace, "nut", "localhost", "debug", "util-0.1.0.nut"))
+	c.Check(res.Lock, IsNil)
+	_, err = os.Stat(filepath.Join(res.Nuts[0].Dir, "util.go"))
+	c.Check(err, IsNil)
+	c.Check(in.downloads, HasLen, 0)
+
+	// identity is checked even without check
+	buf := new(bytes.Buffer)
+	nw := NewNutWriter(buf)
+	c.Assert(nw.Add("util.go", []byte("// Package util is used to test nut.\npackage util\n")), IsNil)
+	c.Assert(nw.Add(SpecFileName, []byte(`{"Version": "0.1.0", "Vendor": "../../../pwned"}`)), IsNil)
+	c.Assert(nw.Close(), IsNil)
+	c.Assert(ioutil.WriteFile(fileName, buf.Bytes(), 0644), IsNil)
+	i = in.installer(c)
+	i.Prefix = "localhost"
+	i.NoCheck = true
+	_, err = i.InstallFile(fileName)
+	c.Check(err, ErrorMatches, `Nut has invalid vendor "../../../pwned".`)
+	fis, err := ioutil.ReadDir(i.Workspace)
+	c.Assert(err, IsNil)
+	c.Check(fis, HasLen, 0)
+}
@@ -0,0 +1,150 @@
+package nut
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+const (
+	LockFileName = "nut.lock"
+)
+
+// Describes lock file nut.lock: exact versions of all nuts package depends on, directly or indirectly.
+type Lock struct {
+	Nuts []LockedNut
+}
+
+// Describes single nut in lock file.
+type LockedNut struct {
+	ImportPath string
+	Vendor     string
+	Name       string
+	Version    Version
+	URL        string // URL nut was downloaded from
+	SHA256     string // hex-encoded SHA-256 of .nut file
+}
+
+// check interface
+var (
+	_ io.ReaderFrom = &Lock{}
+	_ io.WriterTo   = &Lock{}
+)
+
+// Returns hex-encoded SHA-256 of .nut file content.
+func NutHash(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// Returns locked nut for given nut and its .nut file content.
+func NewLockedNut(importPath, url string, nf *NutFile, b []byte) *LockedNut {
+	return NewLockedNutHash(importPath, url, nf, NutHash(b))
+}
+
+// Returns locked nut for given nut and hex-encoded SHA-256 of its .nut file.
+func NewLockedNutHash(importPath, url string, nf *NutFile, hash string) *LockedNut {
+	return &LockedNut{
+		ImportPath: importPath,
+		Vendor:     nf.Vendor,
+		Name:       nf.NutName(),
+		Version:    nf.Version,
+		URL:        url,
+		SHA256:     hash,
+	}
+}
+
+// Checks that .nut file content and nut match locked nut.
+func (ln *LockedNut) Verify(nf *NutFile, b []byte) error {
+	return ln.VerifyHash(nf, NutHash(b))
+}
+
+// Checks that hex-encoded SHA-256 of .nut file and nut match locked nut.
+func (ln *LockedNut) VerifyHash(nf *NutFile, h string) error {
+	if h != ln.SHA256 {
+		return fmt.Errorf("SHA-256 mismatch for %s %s from %s: expected %s, got %s.", ln.ImportPath, ln.Version, ln.URL, ln.SHA256, h)
+	}
+	if nf.Vendor != ln.Vendor || nf.NutName() != ln.Name || nf.Version.String() != ln.Version.String() {
+		return fmt.Errorf("Nut mismatch for %s from %s: expected %s/%s %s, got %s/%s %s.", ln.ImportPath, ln.URL,
+			ln.Vendor, ln.Name, ln.Version, nf.Vendor, nf.NutName(), nf.Version)
+	}
+	return nil
+}
+
+// Returns locked nut with given import path, or nil.
+func (lock *Lock) Find(importPath string) *LockedNut {
+	for i := range lock.Nuts {
+		if lock.Nuts[i].ImportPath == importPath {
+			return &lock.Nuts[i]
+		}
+	}
+	return nil
+}
+
+// Adds or replaces locked nut, keeping nuts sorted by import path.
+func (lock *Lock) Add(ln *LockedNut) {
+	if old := lock.Find(ln.ImportPath); old != nil {
+		*old = *ln
+		return
+	}
+
+	lock.Nuts = append(lock.Nuts, *ln)
+	sort.Sort(byImportPath(lock.Nuts))
+}
+
+// Reads lock from specified file.
+func (lock *Lock) ReadFile(fileName string) (err error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	_, err = lock.ReadFrom(f)
+	return
+}
+
+// ReadFrom reads lock from r until EOF.
+// The return value n is the number of bytes read.
+// Any error except io.EOF encountered during the read is also returned.
+// Implements io.ReaderFrom.
+func (lock *Lock) ReadFrom(r io.Reader) (n int64, err error) {
+	var b []byte
+	b, err = ioutil.ReadAll(r)
+	n = int64(len(b))
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(b, lock)
+	return
+}
+
+// WriteTo writes lock to w.
+// The return value n is the number of bytes written.
+// Any error encountered during the write is also returned.
+// Implements io.WriterTo.
+func (lock *Lock) WriteTo(w io.Writer) (n int64, err error) {
+	var b []byte
+	b, err = json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return
+	}
+
+	b = append(b, '\n')
+	n1, err := w.Write(b)
+	n = int64(n1)
+	return
+}
+
+// byImportPath implements sort.Interface.
+type byImportPath []LockedNut
+
+func (l byImportPath) Len() int           { return len(l) }
+func (l byImportPath) Less(i, j int) bool { return l[i].ImportPath < l[j].ImportPath }
+func (l byImportPath) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
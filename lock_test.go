@@ -0,0 +1,70 @@
+package nut_test
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	. "."
+	. "launchpad.net/gocheck"
+)
+
+type L struct {
+	b  []byte
+	nf *NutFile
+}
+
+var _ = Suite(&L{})
+
+func (f *L) SetUpTest(c *C) {
+	var err error
+	f.b, err = ioutil.ReadFile("../test_nut1/test_nut1-0.0.1.nut")
+	c.Assert(err, IsNil)
+
+	f.nf = new(NutFile)
+	_, err = f.nf.ReadFrom(bytes.NewReader(f.b))
+	c.Assert(err, IsNil)
+}
+
+func (f *L) TestReadFromWriteTo(c *C) {
+	lock := new(Lock)
+	ln := NewLockedNut("gonuts.io/debug/test_nut1", "http://www.gonuts.io/debug/test_nut1/0.0.1", f.nf, f.b)
+	lock.Add(ln)
+	lock.Add(&LockedNut{ImportPath: "gonuts.io/aleksi/nut", Vendor: "aleksi", Name: "nut", Version: Version{Minor: 3}})
+	c.Check(lock.Nuts, HasLen, 2)
+	c.Check(lock.Nuts[0].ImportPath, Equals, "gonuts.io/aleksi/nut")
+	c.Check(lock.Find("gonuts.io/debug/test_nut1"), DeepEquals, ln)
+	c.Check(lock.Find("gonuts.io/debug/test_nut2"), IsNil)
+
+	// replace
+	lock.Add(&LockedNut{ImportPath: "gonuts.io/aleksi/nut", Vendor: "aleksi", Name: "nut", Version: Version{Minor: 3, Patch: 1}})
+	c.Check(lock.Nuts, HasLen, 2)
+	c.Check(lock.Find("gonuts.io/aleksi/nut").Version.String(), Equals, "0.3.1")
+
+	buf := new(bytes.Buffer)
+	n, err := lock.WriteTo(buf)
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, int64(buf.Len()))
+
+	lock2 := new(Lock)
+	_, err = lock2.ReadFrom(buf)
+	c.Assert(err, IsNil)
+	c.Check(lock2, DeepEquals, lock)
+}
+
+func (f *L) TestVerify(c *C) {
+	ln := NewLockedNut("gonuts.io/debug/test_nut1", "http://www.gonuts.io/debug/test_nut1/0.0.1", f.nf, f.b)
+	c.Check(ln.Vendor, Equals, "debug")
+	c.Check(ln.Name, Equals, "test_nut1")
+	c.Check(ln.Version.String(), Equals, "0.0.1")
+	c.Check(ln.SHA256, Equals, NutHash(f.b))
+	c.Check(ln.SHA256, HasLen, 64)
+	c.Check(ln.Verify(f.nf, f.b), IsNil)
+
+	b := append([]byte(nil), f.b...)
+	b = append(b, 0)
+	c.Check(ln.Verify(f.nf, b), ErrorMatches, `SHA-256 mismatch for gonuts.io/debug/test_nut1 0.0.1 from .+: expected [0-9a-f]{64}, got [0-9a-f]{64}.`)
+
+	other := *ln
+	other.Version = Version{Patch: 2}
+	c.Check(other.Verify(f.nf, f.b), ErrorMatches, `Nut mismatch for gonuts.io/debug/test_nut1 from .+: expected debug/test_nut1 0.0.2, got debug/test_nut1 0.0.1.`)
+}
@@ -0,0 +1,135 @@
+package nut
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	ManifestFileName      = "nut.manifest"
+	ManifestFormatVersion = 1
+)
+
+// Describes manifest of nut content, stored in file nut.manifest inside nut.
+// Manifest lists all files in nut except manifest itself and signature.
+type Manifest struct {
+	FormatVersion int
+	Files         []ManifestFile
+	TotalSize     int64
+}
+
+// Describes single file in manifest.
+type ManifestFile struct {
+	Name   string
+	Size   int64
+	SHA256 string // hex-encoded SHA-256 of file content
+}
+
+// Returns new empty manifest in current format.
+func NewManifest() *Manifest {
+	return &Manifest{FormatVersion: ManifestFormatVersion, Files: []ManifestFile{}}
+}
+
+// Adds file with given name and content to manifest.
+func (m *Manifest) Add(name string, b []byte) {
+	h := sha256.Sum256(b)
+	m.Files = append(m.Files, ManifestFile{Name: name, Size: int64(len(b)), SHA256: hex.EncodeToString(h[:])})
+	m.TotalSize += int64(len(b))
+}
+
+// Returns true for service files inside nut which are not part of package: signature and manifest.
+// They are not unpacked.
+func IsServiceFile(name string) bool {
+	return name == SignatureFileName || name == ManifestFileName
+}
+
+// Returns manifest of nut, or nil if nut doesn't contain it (was packed by older version of nut).
+func (nf *NutFile) Manifest() (m *Manifest, err error) {
+	for _, f := range nf.Reader.File {
+		if f.Name != ManifestFileName {
+			continue
+		}
+
+		var b []byte
+		b, err = readFile(f)
+		if err != nil {
+			return
+		}
+		m = new(Manifest)
+		err = json.Unmarshal(b, m)
+		if err != nil {
+			err = fmt.Errorf("Bad manifest: %s", err)
+		}
+		return
+	}
+
+	return
+}
+
+// Checks nut content against manifest, if nut contains it.
+func (nf *NutFile) VerifyManifest() error {
+	m, err := nf.Manifest()
+	if err != nil || m == nil {
+		return err
+	}
+	if m.FormatVersion != ManifestFormatVersion {
+		return fmt.Errorf("Bad manifest: unsupported format version %d.", m.FormatVersion)
+	}
+
+	listed := make(map[string]*ManifestFile, len(m.Files))
+	var total int64
+	for i := range m.Files {
+		mf := &m.Files[i]
+		listed[mf.Name] = mf
+		total += mf.Size
+	}
+	if total != m.TotalSize {
+		return fmt.Errorf("Bad manifest: total size %d, sum of file sizes %d.", m.TotalSize, total)
+	}
+
+	for _, f := range nf.Reader.File {
+		if IsServiceFile(f.Name) || f.Mode().IsDir() {
+			continue
+		}
+
+		mf := listed[f.Name]
+		if mf == nil {
+			return fmt.Errorf("File %q is not listed in manifest.", f.Name)
+		}
+		delete(listed, f.Name)
+
+		h, size, err := fileHash(f)
+		if err != nil {
+			return fmt.Errorf("File %q: %s", f.Name, err)
+		}
+		if size != mf.Size || h != mf.SHA256 {
+			return fmt.Errorf("File %q does not match manifest: nut is truncated or modified.", f.Name)
+		}
+	}
+
+	for name := range listed {
+		return fmt.Errorf("File %q is listed in manifest, but missing: nut is truncated or modified.", name)
+	}
+	return nil
+}
+
+// Returns hex-encoded SHA-256 and size of file content.
+func fileHash(f *zip.File) (hash string, size int64, err error) {
+	r, err := f.Open()
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	size, err = io.Copy(h, r)
+	if err != nil {
+		return
+	}
+	hash = hex.EncodeToString(h.Sum(nil))
+	return
+}
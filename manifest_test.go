@@ -0,0 +1,100 @@
+package nut_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+
+	. "."
+	. "launchpad.net/gocheck"
+)
+
+type M struct{}
+
+var _ = Suite(&M{})
+
+// Returns nut with given files and manifest (if not nil).
+func makeNut(c *C, files map[string]string, names []string, m *Manifest) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		c.Assert(err, IsNil)
+		_, err = w.Write([]byte(files[name]))
+		c.Assert(err, IsNil)
+	}
+	if m != nil {
+		b, err := json.Marshal(m)
+		c.Assert(err, IsNil)
+		w, err := zw.Create(ManifestFileName)
+		c.Assert(err, IsNil)
+		_, err = w.Write(b)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(zw.Close(), IsNil)
+	return buf
+}
+
+func (*M) TestManifest(c *C) {
+	files := map[string]string{
+		"a.go":     "// Package a is used to test nut.\npackage a\n",
+		"LICENSE":  "license",
+		"nut.json": `{"Version": "0.0.1", "Vendor": "debug"}`,
+	}
+	names := []string{"a.go", "LICENSE", "nut.json"}
+	m := NewManifest()
+	for _, name := range names {
+		m.Add(name, []byte(files[name]))
+	}
+	c.Check(m.TotalSize, Equals, int64(len(files["a.go"])+len(files["LICENSE"])+len(files["nut.json"])))
+	c.Check(m.Files[1], Equals, ManifestFile{Name: "LICENSE", Size: 7, SHA256: NutHash([]byte("license"))})
+
+	// valid
+	nf := new(NutFile)
+	_, err := nf.ReadFrom(makeNut(c, files, names, m))
+	c.Assert(err, IsNil)
+	c.Check(nf.Name, Equals, "a")
+	m2, err := nf.Manifest()
+	c.Assert(err, IsNil)
+	c.Check(m2, DeepEquals, m)
+
+	// without manifest
+	_, err = nf.ReadFrom(makeNut(c, files, names, nil))
+	c.Assert(err, IsNil)
+	m2, err = nf.Manifest()
+	c.Check(m2, IsNil)
+	c.Check(err, IsNil)
+
+	// truncated
+	_, err = nf.ReadFrom(makeNut(c, files, names[1:], m))
+	c.Check(err, ErrorMatches, `File "a.go" is listed in manifest, but missing: nut is truncated or modified.`)
+
+	// modified
+	modified := map[string]string{"a.go": files["a.go"], "LICENSE": "LICENSE", "nut.json": files["nut.json"]}
+	_, err = nf.ReadFrom(makeNut(c, modified, names, m))
+	c.Check(err, ErrorMatches, `File "LICENSE" does not match manifest: nut is truncated or modified.`)
+
+	// extra file
+	extra := map[string]string{"b.go": "package a\n"}
+	for k, v := range files {
+		extra[k] = v
+	}
+	_, err = nf.ReadFrom(makeNut(c, extra, append(names, "b.go"), m))
+	c.Check(err, ErrorMatches, `File "b.go" is not listed in manifest.`)
+
+	// bad manifest
+	bad := *m
+	bad.TotalSize++
+	_, err = nf.ReadFrom(makeNut(c, files, names, &bad))
+	c.Check(err, ErrorMatches, `Bad manifest: total size \d+, sum of file sizes \d+.`)
+	bad = *m
+	bad.FormatVersion = 2
+	_, err = nf.ReadFrom(makeNut(c, files, names, &bad))
+	c.Check(err, ErrorMatches, `Bad manifest: unsupported format version 2.`)
+}
+
+func (*M) TestIsServiceFile(c *C) {
+	c.Check(IsServiceFile(ManifestFileName), Equals, true)
+	c.Check(IsServiceFile(SignatureFileName), Equals, true)
+	c.Check(IsServiceFile(SpecFileName), Equals, false)
+}
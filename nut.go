@@ -5,35 +5,42 @@ import (
 	"bytes"
 	"fmt"
 	"go/build"
+	"go/token"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strings"
 )
 
-// Check package for errors and return them.
-func CheckPackage(pack *build.Package) (errors []string) {
+// Check package for errors and return them. See PackageFindings.
+func CheckPackage(pack *build.Package) []string {
+	return FindingStrings(PackageFindings(pack))
+}
+
+// Checks package and returns findings with default severities.
+func PackageFindings(pack *build.Package) (findings []Finding) {
 	// check name
 	if strings.ToLower(pack.Name) != pack.Name {
-		errors = append(errors, `Package name should be lower case.`)
+		findings = append(findings, NewFinding(RulePackageName, "", "", `Package name should be lower case.`))
 	}
 	if strings.HasPrefix(pack.Name, "_") {
-		errors = append(errors, `Package name should not starts with "_".`)
+		findings = append(findings, NewFinding(RulePackageName, "", "", `Package name should not starts with "_".`))
 	}
 	if strings.HasSuffix(pack.Name, "_") {
-		errors = append(errors, `Package name should not ends with "_".`)
+		findings = append(findings, NewFinding(RulePackageName, "", "", `Package name should not ends with "_".`))
 	}
 	if strings.HasSuffix(pack.Name, "_test") {
-		errors = append(errors, `Package name should not ends with "_test".`)
+		findings = append(findings, NewFinding(RulePackageName, "", "", `Package name should not ends with "_test".`))
 	}
 
-	// check doc summary
+	// check doc summary (commands are documented in free form)
 	r := regexp.MustCompile(fmt.Sprintf(`Package %s .+\.`, pack.Name))
-	if !r.MatchString(pack.Doc) {
-		errors = append(errors, fmt.Sprintf(`Package summary in code should be in form "Package %s ... ."`, pack.Name))
+	if pack.Name != "main" && !r.MatchString(pack.Doc) {
+		findings = append(findings, NewFinding(RulePackageDoc, "", "", `Package summary in code should be in form "Package %s ... ."`, pack.Name))
 	}
 
 	return
@@ -42,21 +49,109 @@ func CheckPackage(pack *build.Package) (errors []string) {
 // Describes nut – a Go package with associated meta-information.
 // It embeds Spec and build.Package to provide easy access to properties:
 // Nut.Name instead of Nut.Package.Name, Nut.Version instead of Nut.Spec.Version.
+// Nut may also contain packages in subdirectories.
 type Nut struct {
 	Spec
 	build.Package
+
+	// Packages in subdirectories: map from slash-separated directory (relative to nut root) to package.
+	Subpackages map[string]*build.Package
 }
 
-// Check nut for errors and return them. Calls Spec.Check() and CheckPackage().
-func (nut *Nut) Check() (errors []string) {
-	errors = nut.Spec.Check()
-	errors = append(errors, CheckPackage(&nut.Package)...)
+// Check nut for errors and return them. See Findings.
+func (nut *Nut) Check() []string {
+	return FindingStrings(nut.Findings())
+}
+
+// Checks nut and returns findings with severities overridden by nut.Rules.
+// Calls Spec.Findings(), Spec.ImportFindings() and PackageFindings() for all packages in nut,
+// and registered checkers (see RegisterChecker) with files in nut directory (Package.Dir).
+func (nut *Nut) Findings() (findings []Finding) {
+	var files fs.FS
+	if nut.Dir != "" {
+		files = os.DirFS(nut.Dir)
+	}
+	return nut.Rules.Apply(nut.findings(files))
+}
+
+// Returns findings with default severities, running registered checkers with given files.
+func (nut *Nut) findings(files fs.FS) (findings []Finding) {
+	findings = nut.Spec.findings()
+	findings = append(findings, nut.Spec.importFindings(nut.AllImports())...)
+	findings = append(findings, PackageFindings(&nut.Package)...)
+	if nut.IsCommand() && nut.Command == "" {
+		findings = append(findings, NewFinding(RuleCommand, "Command", "", "Binary nut (package main) should have command name in Command."))
+	}
+	if !nut.IsCommand() && nut.Command != "" {
+		findings = append(findings, NewFinding(RuleCommand, "Command", "", `Command should be set only for binary nut (package main).`))
+	}
+
+	packages := nut.Packages()
+	for _, dir := range nut.PackageDirs() {
+		pack := packages[dir]
+		if dir != "." && pack.Name != "" { // Name is empty if there are no Go files for current platform
+			for _, f := range PackageFindings(pack) {
+				f.File = dir
+				f.Message = fmt.Sprintf("%s: %s", dir, f.Message)
+				findings = append(findings, f)
+			}
+		}
+
+		for _, imp := range pack.Imports {
+			if _, ok := nut.InternalImport(dir, imp); !ok && build.IsLocalImport(imp) {
+				findings = append(findings, NewFinding(RuleLocalImport, "", dir, "Local import %q in %s doesn't refer to package in nut.", imp, dir))
+			}
+		}
+	}
+
+	findings = append(findings, runCheckers(nut, files)...)
 	return
 }
 
+// Returns sorted imports of all packages in nut and their tests without duplicates,
+// except imports of packages in nut itself.
+func (nut *Nut) AllImports() []string {
+	return nut.imports(true)
+}
+
+// Checks that nut has given vendor, name and version, and that vendor and name are safe to use in paths.
+// Empty vendor or name and nil version are not compared.
+func (nut *Nut) CheckIdentity(vendor, name string, version *Version) error {
+	if !VendorRegexp.MatchString(nut.Vendor) {
+		return fmt.Errorf("Nut has invalid vendor %q.", nut.Vendor)
+	}
+	if !token.IsIdentifier(nut.NutName()) || nut.NutName() == "main" {
+		return fmt.Errorf("Nut has invalid name %q.", nut.NutName())
+	}
+
+	if vendor != "" && vendor != nut.Vendor {
+		return fmt.Errorf("Expected nut vendor %q, got %q.", vendor, nut.Vendor)
+	}
+	if name != "" && name != nut.NutName() {
+		return fmt.Errorf("Expected nut name %q, got %q.", name, nut.NutName())
+	}
+	if version != nil && (version.Compare(&nut.Version) != 0 || (version.Build != "" && version.Build != nut.Version.Build)) {
+		return fmt.Errorf("Expected nut version %s, got %s.", version, nut.Version)
+	}
+	return nil
+}
+
+// Returns true for binary nut (package main).
+func (nut *Nut) IsCommand() bool {
+	return nut.Package.Name == "main"
+}
+
+// Returns name of nut: command name for binary nut (package main), package name otherwise.
+func (nut *Nut) NutName() string {
+	if nut.IsCommand() && nut.Command != "" {
+		return nut.Command
+	}
+	return nut.Package.Name
+}
+
 // Returns canonical filename in format <name>-<version>.nut
 func (nut *Nut) FileName() string {
-	return fmt.Sprintf("%s-%s.nut", nut.Name, nut.Version)
+	return fmt.Sprintf("%s-%s.nut", nut.NutName(), nut.Version)
 }
 
 // Returns canonical filepath in format <prefix>/<vendor>/<name>-<version>.nut
@@ -67,19 +162,23 @@ func (nut *Nut) FilePath(prefix string) string {
 
 // Returns canonical import path in format <prefix>/<vendor>/<name>
 func (nut *Nut) ImportPath(prefix string) string {
-	return fmt.Sprintf("%s/%s/%s", prefix, nut.Vendor, nut.Name)
+	return fmt.Sprintf("%s/%s/%s", prefix, nut.Vendor, nut.NutName())
 }
 
-// Read nut from directory: package from <dir> and spec from <dir>/<SpecFileName>.
+// Read nut from directory: package from <dir>, packages from its subdirectories and spec from <dir>/<SpecFileName>.
 func (nut *Nut) ReadFrom(dir string) (err error) {
 	// This method is called ReadFrom to prevent code n.ReadFrom(r) from calling n.Spec.ReadFrom(r).
 
-	// read package
+	// read packages
 	pack, err := build.ImportDir(dir, 0)
 	if err != nil {
 		return
 	}
 	nut.Package = *pack
+	nut.Subpackages, err = ImportSubpackages(&build.Default, dir)
+	if err != nil {
+		return
+	}
 
 	// read spec
 	f, err := os.Open(filepath.Join(dir, SpecFileName))
@@ -95,6 +194,7 @@ func (nut *Nut) ReadFrom(dir string) (err error) {
 type NutFile struct {
 	Nut
 	Reader *zip.Reader
+	closer io.Closer // file opened by OpenFile
 }
 
 // check interface
@@ -102,7 +202,59 @@ var (
 	_ io.ReaderFrom = &NutFile{}
 )
 
-// Reads nut from specified file.
+// Check nut file for errors and return them. See Findings.
+func (nf *NutFile) Check() []string {
+	return FindingStrings(nf.Findings())
+}
+
+// Checks nut file and returns findings with severities overridden by nf.Rules. Checks nut like Nut.Findings()
+// (registered checkers get nut file itself as files), and checks that files referenced by nut are present in it:
+// extra files from spec and files matched by //go:embed patterns.
+func (nf *NutFile) Findings() []Finding {
+	return nf.Rules.Apply(nf.findings())
+}
+
+// Checks nut file like Findings for consumer installing or publishing it: nf.Rules may only raise severities
+// (so nut can't disable checks required by consumer), then severities are overridden by consumer's rules.
+func (nf *NutFile) ConsumerFindings(rules Rules) []Finding {
+	return rules.Apply(nf.Rules.stricter().Apply(nf.findings()))
+}
+
+// Returns findings of nut file with default severities.
+func (nf *NutFile) findings() (findings []Finding) {
+	findings = nf.Nut.findings(nf)
+
+	names := make([]string, 0, len(nf.Reader.File))
+	for _, f := range nf.Reader.File {
+		if !f.Mode().IsDir() {
+			names = append(names, f.Name)
+		}
+	}
+
+	for _, f := range nf.ExtraFiles {
+		if len(MatchExtraFiles(f, names)) == 0 {
+			findings = append(findings, NewFinding(RuleMissingExtraFiles, "ExtraFiles", f, "Extra files %q are missing from nut.", f))
+		}
+	}
+
+	packages := nf.Packages()
+	for _, dir := range nf.PackageDirs() {
+		patterns := EmbedPatterns(packages[dir])
+		if len(patterns) == 0 {
+			continue
+		}
+
+		files := filesIn(names, dir)
+		for _, pattern := range patterns {
+			if len(MatchEmbedPattern(pattern, files)) == 0 {
+				findings = append(findings, NewFinding(RuleMissingEmbed, "", dir, "Pattern %q of //go:embed in %s matches no files in nut.", pattern, dir))
+			}
+		}
+	}
+	return
+}
+
+// Reads nut from specified file into memory. See OpenFile for reading without buffering.
 func (nf *NutFile) ReadFile(fileName string) (err error) {
 	f, err := os.Open(fileName)
 	if err != nil {
@@ -114,19 +266,74 @@ func (nf *NutFile) ReadFile(fileName string) (err error) {
 	return
 }
 
-// ReadFrom reads nut from r until EOF.
+// Opens nut from specified file without reading it into memory (see OpenReaderAt).
+// File is kept open until Close is called.
+func (nf *NutFile) OpenFile(fileName string) (err error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return
+	}
+	fi, err := f.Stat()
+	if err == nil {
+		err = nf.OpenReaderAt(f, fi.Size())
+	}
+	if err != nil {
+		f.Close()
+		return
+	}
+	nf.closer = f
+	return
+}
+
+// Closes file opened by OpenFile. Does nothing for nuts read otherwise.
+func (nf *NutFile) Close() (err error) {
+	if nf.closer != nil {
+		err = nf.closer.Close()
+		nf.closer = nil
+	}
+	return
+}
+
+// ReadFrom reads nut from r until EOF into memory.
 // The return value n is the number of bytes read.
 // Any error except io.EOF encountered during the read is also returned.
 // Implements io.ReaderFrom.
+// Size of nut is limited by MaxNutSize. See OpenReaderAt for other checks.
 func (nf *NutFile) ReadFrom(r io.Reader) (n int64, err error) {
 	var b []byte
-	b, err = ioutil.ReadAll(r)
+	b, err = ioutil.ReadAll(io.LimitReader(r, MaxNutSize+1))
 	n = int64(len(b))
 	if err != nil {
 		return
 	}
+	if n > MaxNutSize {
+		err = fmt.Errorf("NutFile.ReadFrom: nut is too big: more than %d bytes.", MaxNutSize)
+		return
+	}
+
+	err = nf.OpenReaderAt(bytes.NewReader(b), n)
+	return
+}
 
-	nf.Reader, err = zip.NewReader(bytes.NewReader(b), n)
+// Reads nut of given size from r without buffering whole archive: files are read from r one by one
+// on access, so r should remain readable while nut is used.
+// Nut archive is checked with CheckArchive, and its size is limited by MaxNutSize.
+// If nut contains manifest, nut content is checked against it (file by file).
+func (nf *NutFile) OpenReaderAt(r io.ReaderAt, size int64) (err error) {
+	if size > MaxNutSize {
+		err = fmt.Errorf("NutFile.OpenReaderAt: nut is too big: %d bytes (max %d).", size, MaxNutSize)
+		return
+	}
+
+	nf.Reader, err = zip.NewReader(r, size)
+	if err != nil {
+		return
+	}
+	err = CheckArchive(nf.Reader)
+	if err != nil {
+		return
+	}
+	err = nf.VerifyManifest()
 	if err != nil {
 		return
 	}
@@ -150,7 +357,7 @@ func (nf *NutFile) ReadFrom(r io.Reader) (n int64, err error) {
 		}
 	}
 	if specReader == nil {
-		err = fmt.Errorf("NutFile.ReadFrom: %q not found", SpecFileName)
+		err = fmt.Errorf("NutFile.OpenReaderAt: %q not found", SpecFileName)
 		return
 	}
 	spec := &nf.Spec
@@ -159,22 +366,33 @@ func (nf *NutFile) ReadFrom(r io.Reader) (n int64, err error) {
 		return
 	}
 
-	// read package
-	pack, err := nf.context().ImportDir(".", 0)
+	// read packages
+	ctxt := nf.context()
+	pack, err := ctxt.ImportDir(".", 0)
 	if err != nil {
 		return
 	}
 	nf.Package = *pack
+
+	nf.Subpackages = make(map[string]*build.Package)
+	seen := make(map[string]bool)
+	for _, file := range nf.Reader.File {
+		dir := path.Dir(file.Name)
+		if path.Ext(file.Name) != ".go" || dir == "." || !isPackageDir(dir) || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		pack, err = importDir(ctxt, dir)
+		if err != nil {
+			return
+		}
+		if pack != nil {
+			nf.Subpackages[dir] = pack
+		}
+	}
 	return
 }
 
-// byName implements sort.Interface.
-type byName []os.FileInfo
-
-func (f byName) Len() int           { return len(f) }
-func (f byName) Less(i, j int) bool { return f[i].Name() < f[j].Name() }
-func (f byName) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
-
 // Returns build.Context for given nut.
 // Returned value may be used to call normal context methods Import and ImportDir
 // to extract information about package in nut without unpacking it: name, doc, dependencies.
@@ -182,28 +400,31 @@ func (nf *NutFile) context() (ctxt *build.Context) {
 	ctxt = new(build.Context)
 	*ctxt = build.Default
 
-	// FIXME path is ignored (multi-package nuts are not supported yet)
-	ctxt.ReadDir = func(path string) (fi []os.FileInfo, err error) {
-		// log.Printf("nf.ReadDir %q", path)
-
-		fi = make([]os.FileInfo, len(nf.Reader.File))
-		for i, f := range nf.Reader.File {
-			fi[i] = f.FileInfo()
-		}
-		sort.Sort(byName(fi))
-		return fi, nil
+	// paths are slash-separated and relative to nut root
+	ctxt.JoinPath = path.Join
+	ctxt.IsAbsPath = path.IsAbs
+	ctxt.HasSubdir = func(root, dir string) (string, bool) { return "", false }
+	ctxt.IsDir = func(dir string) bool {
+		fi, err := nf.Stat(path.Clean(dir))
+		return err == nil && fi.IsDir()
 	}
-
-	ctxt.OpenFile = func(path string) (io.ReadCloser, error) {
-		// log.Printf("nf.OpenFile %q", path)
-
-		for _, f := range nf.Reader.File {
-			if f.Name == path {
-				return f.Open()
+	ctxt.ReadDir = func(dir string) (fi []os.FileInfo, err error) {
+		entries, err := nf.ReadDir(path.Clean(dir))
+		if err != nil {
+			return
+		}
+		for _, e := range entries {
+			var info os.FileInfo
+			info, err = e.Info()
+			if err != nil {
+				return
 			}
+			fi = append(fi, info)
 		}
-
-		return nil, fmt.Errorf("NutFile.Context.OpenFile: %q not found", path)
+		return
+	}
+	ctxt.OpenFile = func(name string) (io.ReadCloser, error) {
+		return nf.Open(path.Clean(name))
 	}
 
 	return
@@ -1,12 +1,11 @@
 package main
 
 import (
-	"archive/zip"
 	"bytes"
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
 	"go/build"
-	"io"
 	"io/ioutil"
 	"log"
 	"net/url"
@@ -17,12 +16,57 @@ import (
 	"strings"
 
 	. "github.com/AlekSi/nut"
+	"github.com/AlekSi/nut/registry"
 )
 
 type ConfigFile struct {
-	Token string
+	Token string // access token for gonuts.io; other registries use their own tokens
 	V     bool
 	Debug bool
+
+	// Path to file with private key for 'nut sign'.
+	SigningKey string `json:",omitempty"`
+
+	// Base64-encoded ed25519 public keys of trusted nut signers.
+	TrustedKeys []string `json:",omitempty"`
+
+	// Refuse to install unsigned nuts and nuts signed with untrusted keys.
+	RequireSigned bool `json:",omitempty"`
+
+	// Overrides severities of check rules (after Rules in nut.json), e.g. "package-doc": "error".
+	Rules Rules `json:",omitempty"`
+
+	// External checkers (plugins) run by 'nut check', 'nut pack', 'nut install' and 'nut get'.
+	Checkers []*ExecChecker `json:",omitempty"`
+
+	// Maps import prefixes to registries, e.g. "nuts.example.com": {"URL": "https://nuts.example.com/api"}.
+	// Entries are added to NutImportPrefixes (and may replace gonuts.io).
+	Registries map[string]*RegistryConfig `json:",omitempty"`
+
+	// Import prefix of registry for short nut names (<vendor>/<name>) and 'nut publish', gonuts.io if empty.
+	DefaultRegistry string `json:",omitempty"`
+
+	// Executable printing access tokens for registries without them (see RegistryToken).
+	CredentialHelper string `json:",omitempty"`
+
+	// Token required for publishing to 'nut serve'; not related to Token.
+	ServeToken string `json:",omitempty"`
+}
+
+// Describes nut registry in config.
+type RegistryConfig struct {
+	URL              string // base URL, nuts are at <URL>/<vendor>/<name>
+	Token            string `json:",omitempty"` // access token for 'nut publish'
+	CredentialHelper string `json:",omitempty"` // overrides CredentialHelper from ConfigFile
+
+	// Allow plain HTTP URL (not recommended).
+	Insecure bool `json:",omitempty"`
+
+	// TLS settings: PEM file with CA certificates trusted in addition to system ones,
+	// and PEM files with client certificate and its private key for mutual TLS.
+	CAFile   string `json:",omitempty"`
+	CertFile string `json:",omitempty"`
+	KeyFile  string `json:",omitempty"`
 }
 
 const (
@@ -35,15 +79,22 @@ var (
 	SrcDir       string // src directory in current workspace
 	NutDir       string // nut directory in current workspace
 
-	// Maps import prefixes to hosts serving nuts.
+	// Maps import prefixes to base URLs of registries serving nuts.
 	// Three reasons for it:
-	//   - third-party nut servers (TODO to be implemented);
+	//   - third-party nut registries (see Registries in ConfigFile);
 	//   - testing with dev_appserver;
 	//   - no GAE for second-level domains.
-	NutImportPrefixes = map[string]string{"gonuts.io": "www.gonuts.io"}
+	NutImportPrefixes = map[string]string{"gonuts.io": "https://www.gonuts.io"}
 
-	Config ConfigFile
-	vHelp  string = fmt.Sprintf("be verbose (may be read from ~/%s)", ConfigFileName)
+	// Maps import prefixes to settings of registries added with addRegistry.
+	registries = make(map[string]*RegistryConfig)
+
+	// Import prefix of registry for short nut names and 'nut publish'.
+	DefaultRegistry = "gonuts.io"
+
+	Config     ConfigFile
+	vHelp      string = fmt.Sprintf("be verbose (may be read from ~/%s)", ConfigFileName)
+	signedHelp string = fmt.Sprintf("refuse unsigned and untrusted nuts (may be read from RequireSigned in ~/%s)", ConfigFileName)
 )
 
 func init() {
@@ -96,6 +147,25 @@ func init() {
 		}
 	}
 
+	for _, err := range RegisterConfigCheckers(Config.Checkers) {
+		log.Printf("Warning: %s: %s", path, err)
+	}
+	for _, f := range Config.Rules.Findings() {
+		log.Printf("Warning: %s: %s", path, f)
+	}
+	for prefix, r := range Config.Registries {
+		if err = addRegistry(prefix, r); err != nil {
+			log.Printf("Warning: %s: %s", path, err)
+		}
+	}
+	if Config.DefaultRegistry != "" {
+		if _, ok := NutImportPrefixes[Config.DefaultRegistry]; ok {
+			DefaultRegistry = Config.DefaultRegistry
+		} else {
+			log.Printf("Warning: %s: Unknown default registry %q.", path, Config.DefaultRegistry)
+		}
+	}
+
 	// set logger flags
 	if Config.Debug {
 		log.SetFlags(log.Ldate | log.Lmicroseconds | log.Llongfile)
@@ -104,10 +174,125 @@ func init() {
 	// for development
 	env := os.Getenv("GONUTS_IO_SERVER")
 	if env != "" {
-		u, err := url.Parse(env)
-		FatalIfErr(err)
-		NutImportPrefixes["gonuts.io"] = u.Host
+		FatalIfErr(addRegistry("gonuts.io", &RegistryConfig{URL: env, Insecure: true}))
+	}
+}
+
+// Checks registry base URL and adds it to NutImportPrefixes.
+func addRegistry(prefix string, r *RegistryConfig) error {
+	if r == nil || prefix == "" || strings.ContainsAny(prefix, "/:") {
+		return fmt.Errorf("Invalid registry %q.", prefix)
+	}
+	u, err := url.Parse(r.URL)
+	if err == nil && ((u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "") {
+		err = fmt.Errorf("URL should be absolute http(s) URL without query")
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid URL %q for registry %q: %s.", r.URL, prefix, err)
+	}
+	if u.Scheme == "http" && !r.Insecure {
+		return fmt.Errorf("Registry %q uses plain HTTP URL %q, set Insecure to allow it.", prefix, r.URL)
+	}
+	NutImportPrefixes[prefix] = strings.TrimSuffix(u.String(), "/")
+	registries[prefix] = r
+	return nil
+}
+
+// Returns client for registry with given import prefix (see NutImportPrefixes) with its TLS settings, without token.
+// Client for empty prefix has no base URL and may be used only with absolute HTTPS URLs.
+func RegistryClient(prefix string, verbose bool) (c *registry.Client, err error) {
+	c = new(registry.Client)
+	if prefix != "" {
+		base, ok := NutImportPrefixes[prefix]
+		if !ok {
+			err = fmt.Errorf("Unknown registry %q.", prefix)
+			return
+		}
+		c, err = registry.NewClient(base)
+		if err != nil {
+			return
+		}
+
+		if r := registries[prefix]; r != nil {
+			c.Insecure = r.Insecure
+			if r.CAFile != "" || r.CertFile != "" || r.KeyFile != "" {
+				c.HTTPClient, err = registry.NewHTTPClient(r.CAFile, r.CertFile, r.KeyFile)
+				if err != nil {
+					err = fmt.Errorf("Invalid TLS settings for registry %q: %s", prefix, err)
+					return
+				}
+			}
+		}
+	}
+	if verbose {
+		c.Logf = log.Printf
+	}
+	return
+}
+
+// Returns name of environment variable with access token for registry with given import prefix:
+// NUT_TOKEN_ and prefix in upper case with other characters replaced by "_", e.g. NUT_TOKEN_GONUTS_IO.
+func TokenEnv(prefix string) string {
+	return "NUT_TOKEN_" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			return r
+		}
+		return '_'
+	}, prefix)
+}
+
+// Returns access token for registry with given import prefix. Token is taken from (in that order):
+// environment variable for that prefix (see TokenEnv), NUT_TOKEN environment variable (for DefaultRegistry only),
+// registry entry in config, Token in config (for gonuts.io only), or credential helper executable,
+// which is run as "<helper> get <prefix> <URL>" and should print token.
+// Empty token is returned if none is found.
+func RegistryToken(prefix string) (token string, err error) {
+	if token = os.Getenv(TokenEnv(prefix)); token != "" {
+		return
+	}
+	if prefix == DefaultRegistry {
+		if token = os.Getenv("NUT_TOKEN"); token != "" {
+			return
+		}
+	}
+
+	r := Config.Registries[prefix]
+	if r == nil {
+		r = new(RegistryConfig)
+	}
+	if r.Token != "" {
+		token = r.Token
+		return
+	}
+	if prefix == "gonuts.io" && Config.Token != "" {
+		token = Config.Token
+		return
+	}
+
+	helper := r.CredentialHelper
+	if helper == "" {
+		helper = Config.CredentialHelper
+	}
+	if helper == "" {
+		return
+	}
+	var stdout, stderr bytes.Buffer
+	c := exec.Command(helper, "get", prefix, NutImportPrefixes[prefix])
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	err = c.Run()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%s\n%s", err, msg)
+		}
+		err = fmt.Errorf("Credential helper %s failed: %s", helper, err)
+		return
 	}
+	token = strings.TrimSpace(stdout.String())
+	return
 }
 
 func FatalIfErr(err error) {
@@ -121,22 +306,81 @@ func FatalIfErr(err error) {
 	}
 }
 
-// Call 'go install <path>'.
-func InstallPackage(path string, verbose bool) {
-	args := []string{"install"}
-	if verbose {
-		args = append(args, "-v")
+// Returns trusted keys from config.
+func TrustedKeys() (keys []ed25519.PublicKey) {
+	for _, s := range Config.TrustedKeys {
+		key, err := DecodePublicKey(s)
+		FatalIfErr(err)
+		keys = append(keys, key)
+	}
+	return
+}
+
+// Returns installer into current workspace with options from config.
+func NewInstaller(prefix string, requireSigned, noCheck, verbose bool) *Installer {
+	in := &Installer{
+		Workspace:     WorkspaceDir,
+		Prefix:        prefix,
+		Registry:      newHTTPRegistry(verbose),
+		NutImports:    NutImports,
+		TrustedKeys:   TrustedKeys(),
+		RequireSigned: requireSigned,
+		NoCheck:       noCheck,
+		Rules:         Config.Rules,
 	}
-	args = append(args, path)
-	c := exec.Command("go", args...)
 	if verbose {
-		log.Printf("Running %q", strings.Join(c.Args, " "))
+		in.Logf = log.Printf
 	}
-	out, err := c.CombinedOutput()
-	if verbose || err != nil {
-		log.Print(string(out))
+	return in
+}
+
+// Registers checkers from config, skipping ones without Path or with already registered rules
+// (RegisterChecker panics for them). Returns errors for skipped checkers.
+func RegisterConfigCheckers(checkers []*ExecChecker) (errors []error) {
+	for i, c := range checkers {
+		var err error
+		if c == nil || c.Path == "" {
+			err = fmt.Errorf("Skipping checker #%d: no Path given.", i+1)
+		} else {
+			for code := range c.Rules {
+				if _, ok := DefaultRules[code]; ok {
+					err = fmt.Errorf("Skipping checker %s: rule %q is already registered.", c.Path, code)
+					break
+				}
+			}
+		}
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		RegisterChecker(c)
+	}
+	return
+}
+
+// Applies rules from config to findings, logs warnings and returns errors rendered as strings.
+func CheckFindings(findings []Finding, where string) (errors []string) {
+	findings = Config.Rules.Apply(findings)
+	if warnings := FilterFindings(findings, SeverityWarning); len(warnings) != 0 {
+		if where == "" {
+			log.Print("Found warnings:")
+		} else {
+			log.Printf("Found warnings in %s:", where)
+		}
+		for _, w := range warnings {
+			log.Printf("    %s", w)
+		}
+	}
+	return FindingStrings(FilterFindings(findings, SeverityError))
+}
+
+// Logs paths of installed commands.
+func LogCommands(res *InstallResult) {
+	for _, inut := range res.Nuts {
+		if inut.Command != "" {
+			log.Printf("Command %s installed.", inut.Command)
+		}
 	}
-	FatalIfErr(err)
 }
 
 // TODO common functions below are mess for now
@@ -152,26 +396,14 @@ func ReadNut(fileName string) (b []byte, nf *NutFile) {
 	return
 }
 
-// Write nut to GOPATH/nut/<prefix>/<name>-<version>.nut
-func WriteNut(b []byte, prefix string, verbose bool) string {
-	nf := new(NutFile)
-	_, err := nf.ReadFrom(bytes.NewReader(b))
-	FatalIfErr(err)
-
-	// create GOPATH/nut/<prefix>
-	dir := filepath.Join(NutDir, prefix)
-	FatalIfErr(os.MkdirAll(dir, WorkspaceDirPerm))
-
-	// write file
-	dstFilepath := filepath.Join(dir, nf.FileName())
-	if verbose {
-		log.Printf("Writing %s ...", dstFilepath)
-	}
-	FatalIfErr(ioutil.WriteFile(dstFilepath, b, NutFilePerm))
-	return dstFilepath
+// Open nut file without reading it into memory. Caller should close it.
+func OpenNut(fileName string) (nf *NutFile) {
+	nf = new(NutFile)
+	FatalIfErr(nf.OpenFile(fileName))
+	return
 }
 
-// Pack files into nut file with given fileName.
+// Pack files from current directory into nut file with given fileName. See NutWriter.
 func PackNut(fileName string, files []string, verbose bool) {
 	// write nut to temporary file first
 	nutFile, err := ioutil.TempFile("", "nut-")
@@ -182,40 +414,14 @@ func PackNut(fileName string, files []string, verbose bool) {
 		}
 	}()
 
-	nutWriter := zip.NewWriter(nutFile)
-	defer func() {
-		if nutWriter != nil {
-			FatalIfErr(nutWriter.Close())
-		}
-	}()
-
-	// add files to nut with all meta information
+	nw := NewNutWriter(nutFile)
 	for _, file := range files {
 		if verbose {
 			log.Printf("Packing %s ...", file)
 		}
-
-		fi, err := os.Stat(file)
-		FatalIfErr(err)
-
-		fh, err := zip.FileInfoHeader(fi)
-		FatalIfErr(err)
-		fh.Name = file
-
-		f, err := nutWriter.CreateHeader(fh)
-		FatalIfErr(err)
-
-		b, err := ioutil.ReadFile(file)
-		FatalIfErr(err)
-
-		_, err = f.Write(b)
-		FatalIfErr(err)
+		FatalIfErr(nw.AddFiles(".", []string{file}))
 	}
-
-	err = nutWriter.Close()
-	nutWriter = nil
-	FatalIfErr(err)
-
+	FatalIfErr(nw.Close())
 	FatalIfErr(nutFile.Close())
 
 	// move file to specified location and fix permissions
@@ -232,46 +438,34 @@ func PackNut(fileName string, files []string, verbose bool) {
 	FatalIfErr(os.Chmod(fileName, NutFilePerm))
 }
 
-// Unpack nut file with given fileName into dir, overwriting files.
-// Creates dir if needed. Removes dir first if asked.
-func UnpackNut(fileName string, dir string, removeDir, verbose bool) {
-	// check dir
-	_, err := os.Stat(dir)
-	if err == nil && removeDir {
-		if verbose {
-			log.Printf("Removing existing directory %s ...", dir)
-		}
-		FatalIfErr(os.RemoveAll(dir))
-	}
-	FatalIfErr(os.MkdirAll(dir, WorkspaceDirPerm))
-
-	nf := new(NutFile)
-	FatalIfErr(nf.ReadFile(fileName))
-
-	for _, file := range nf.Reader.File {
-		if verbose {
-			log.Printf("Unpacking %s ...", file.Name)
-		}
-
-		src, err := file.Open()
-		FatalIfErr(err)
-
-		dst, err := os.OpenFile(filepath.Join(dir, file.Name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
-		FatalIfErr(err)
-
-		_, err = io.Copy(dst, src)
-		FatalIfErr(err)
+// Unpack nut file with given fileName into dir, overwriting files. See Unpack.
+// If prefix is not empty, imports of packages in nut are rewritten to canonical import paths with that prefix.
+func UnpackNut(fileName string, dir string, prefix string, removeDir, verbose bool) {
+	nf := OpenNut(fileName)
+	defer nf.Close()
 
-		FatalIfErr(src.Close())
-		FatalIfErr(dst.Close())
+	opts := &UnpackOptions{Prefix: prefix, RemoveDir: removeDir}
+	if verbose {
+		opts.Logf = log.Printf
 	}
+	FatalIfErr(Unpack(nf, dir, opts))
 }
 
-// Return imports present in NutImportPrefixes without altering them.
+// Return import paths of nuts for imports with prefixes present in NutImportPrefixes.
+// Imports of packages in nut subdirectories (<prefix>/<vendor>/<name>/<dir>) are replaced with
+// import path of nut (<prefix>/<vendor>/<name>), duplicates are removed.
 func NutImports(imports []string) (nuts []string) {
+	seen := make(map[string]bool)
 	for _, imp := range imports {
 		p := strings.Split(imp, "/")
-		if _, ok := NutImportPrefixes[p[0]]; ok {
+		if _, ok := NutImportPrefixes[p[0]]; !ok {
+			continue
+		}
+		if len(p) > 3 {
+			imp = strings.Join(p[:3], "/")
+		}
+		if !seen[imp] {
+			seen[imp] = true
 			nuts = append(nuts, imp)
 		}
 	}
@@ -23,6 +23,21 @@ func init() {
 	cmdCheck.Long = `
 Checks given spec (.json) or nut (.nut) files.
 If no filenames are given, checks spec nut.json in current directory.
+Errors are reported and make check fail, warnings are only reported.
+Severity of each rule may be changed or rule may be disabled with Rules
+in nut.json and in ~/.nut.json (which takes precedence), for example:
+    "Rules": {"package-doc": "off", "homepage": "warning"}
+When nut file (.nut) is checked, unpacked, installed or published,
+Rules in its nut.json may only raise severities.
+Rules: version, vendor, authors, license, extra-files, homepage, command,
+dependency, rules, unused-dependency, package-name, package-doc,
+local-import, missing-extra-files, missing-embed, checker.
+
+Additional rules may be checked by external executables listed in Checkers
+in ~/.nut.json; they are run with directory containing nut files and should
+print JSON array of findings:
+    "Checkers": [{"Path": "/usr/local/bin/org-check", "Rules": {"org-copyright": "error"}}]
+    [{"Rule": "org-copyright", "File": "a.go", "Message": "No copyright header."}]
 
 Examples:
     nut check
@@ -54,14 +69,15 @@ func runCheck(cmd *Command) {
 			FatalIfErr(err)
 			pack, err := build.ImportDir(".", 0)
 			FatalIfErr(err)
-			errors = spec.Check()
-			errors = append(errors, CheckPackage(pack)...)
+			nut := Nut{Spec: *spec, Package: *pack}
+			nut.Subpackages, err = ImportSubpackages(&build.Default, ".")
+			FatalIfErr(err)
+			errors = CheckFindings(nut.Findings(), arg)
 
 		case "nut":
-			nf := new(NutFile)
-			err := nf.ReadFile(arg)
-			FatalIfErr(err)
-			errors = nf.Check()
+			nf := OpenNut(arg)
+			errors = CheckFindings(nf.ConsumerFindings(Config.Rules), arg)
+			FatalIfErr(nf.Close())
 
 		default:
 			log.Fatalf("%q doesn't end with .json or .nut", arg)
@@ -66,6 +66,13 @@ func runGenerate(cmd *Command) {
 		spec.Authors = []Person{{FullName: ExampleFullName, Email: ExampleEmail}}
 	}
 
+	// command name for binary nut defaults to directory name, like in 'go install'
+	if pack.Name == "main" && spec.Command == "" {
+		wd, err := os.Getwd()
+		FatalIfErr(err)
+		spec.Command = strings.ToLower(filepath.Base(wd))
+	}
+
 	// some extra files
 	if len(spec.ExtraFiles) == 0 {
 		var globs []string
@@ -93,8 +100,10 @@ func runGenerate(cmd *Command) {
 	}
 
 	// check spec and package
-	errors := spec.Check()
-	errors = append(errors, CheckPackage(pack)...)
+	nut := Nut{Spec: *spec, Package: *pack}
+	nut.Subpackages, err = ImportSubpackages(&build.Default, ".")
+	FatalIfErr(err)
+	errors := CheckFindings(nut.Findings(), SpecFileName)
 	if len(errors) != 0 {
 		log.Print("\nNow you should edit nut.json to fix following errors:")
 		for _, e := range errors {
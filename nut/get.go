@@ -1,54 +1,80 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"go/build"
-	"io/ioutil"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
-	"path/filepath"
-	"sort"
+	"os"
 	"strings"
 
 	. "github.com/AlekSi/nut"
+	"github.com/AlekSi/nut/registry"
 )
 
 var (
 	cmdGet = &Command{
 		Run:       runGet,
-		UsageLine: "get [-p prefix] [-v] [name, import path or URL]",
+		UsageLine: "get [-nc] [-p prefix] [-signed] [-update] [-v] [name, import path or URL]",
 		Short:     "download and install nut and dependencies",
 	}
 
-	getP string
-	getV bool
+	getNC     bool
+	getP      string
+	getSigned bool
+	getUpdate bool
+	getV      bool
 )
 
 func init() {
 	cmdGet.Long = `
-Downloads and installs nut and dependencies from http://gonuts.io/ or specified URL.
+Downloads and installs nut and dependencies from https://gonuts.io/ or specified URL.
+Import paths are resolved with registries from Registries in ~/.nut.json
+(<prefix>/<vendor>/<name> is downloaded from <URL>/<vendor>/<name>); short names
+(<vendor>/<name>) are downloaded from DefaultRegistry (gonuts.io if not set).
+Only HTTPS is used, unless registry is marked as Insecure in ~/.nut.json.
+Registries may also have CAFile with additional trusted CA certificates,
+and CertFile and KeyFile with client certificate.
+Vendor, name and version of downloaded nuts should match requested ones.
+Signatures of signed nuts are always checked; with -signed unsigned nuts and
+nuts signed with keys not listed in TrustedKeys in ~/.nut.json are refused.
+Pre-release versions (like 0.3.0-rc.1) are installed only if requested explicitly.
+For dependencies declared in nut.json the highest version satisfying constraint is installed.
+Versions of all nuts are selected before anything is written; if two nuts require
+incompatible versions of the same dependency, nothing is installed.
+Binary nuts (package main) are installed into GOPATH/bin/<command>.
+
+Without arguments installs dependencies of package in current directory.
+Selected versions are recorded in nut.lock, and the same versions are installed
+on next runs (downloaded nuts are checked against SHA-256 hashes in nut.lock).
+Use -update to select versions again and update nut.lock.
 
 Examples:
     nut install aleksi/nut
     nut install aleksi/nut/0.2.0
     nut install gonuts.io/aleksi/nut
     nut install gonuts.io/aleksi/nut/0.2.0
-    nut install http://gonuts.io/aleksi/nut
-    nut install http://gonuts.io/aleksi/nut/0.2.0
+    nut install https://www.gonuts.io/aleksi/nut
+    nut install https://www.gonuts.io/aleksi/nut/0.2.0
+    nut install aleksi/nut/0.3.0-rc.1
 `
 
-	cmdGet.Flag.StringVar(&getP, "p", "", "install prefix in workspace, uses hostname from URL if omitted")
+	cmdGet.Flag.BoolVar(&getNC, "nc", false, "no check (not recommended)")
+	cmdGet.Flag.StringVar(&getP, "p", "", "install prefix in workspace, uses registry prefix or hostname from URL if omitted")
+	cmdGet.Flag.BoolVar(&getSigned, "signed", false, signedHelp)
+	cmdGet.Flag.BoolVar(&getUpdate, "update", false, "select versions again and update "+LockFileName)
 	cmdGet.Flag.BoolVar(&getV, "v", false, vHelp)
 }
 
 // Parse argument, return URL to get nut from and install prefix.
+// Import paths and short names (of nuts in DefaultRegistry) are resolved with NutImportPrefixes.
 func ParseArg(s string) (u *url.URL, prefix string) {
 	var p []string
-	var host string
+	var base string
 	var ok bool
 
 	// full URL - as is
@@ -59,22 +85,25 @@ func ParseArg(s string) (u *url.URL, prefix string) {
 	p = strings.Split(s, "/")
 	if len(p) > 0 {
 		prefix = p[0]
-		host, ok = NutImportPrefixes[prefix]
+		base, ok = NutImportPrefixes[prefix]
 	}
 	if ok {
 		// import path style
-		p[0] = "http://" + host
+		p[0] = base
 		s = strings.Join(p, "/")
 	} else {
 		// short style
-		prefix = "gonuts.io"
-		host = NutImportPrefixes[prefix]
-		s = fmt.Sprintf("http://%s/%s", host, s)
+		prefix = DefaultRegistry
+		base = NutImportPrefixes[prefix]
+		s = base + "/" + s
 	}
 
 parse:
 	u, err := url.Parse(s)
 	FatalIfErr(err)
+	if prefix == "" {
+		prefix = registryPrefix(s)
+	}
 	if prefix == "" {
 		prefix = u.Host
 		if strings.Contains(prefix, ":") {
@@ -89,114 +118,198 @@ parse:
 	return
 }
 
-func get(url *url.URL) (b []byte, err error) {
-	if getV {
-		log.Printf("Getting %s ...", url)
+// Returns import prefix of registry serving given URL, or empty string.
+func registryPrefix(s string) (prefix string) {
+	var base string
+	for p, b := range NutImportPrefixes {
+		if strings.HasPrefix(s, b+"/") && len(b) > len(base) {
+			prefix, base = p, b
+		}
 	}
+	return
+}
 
-	req, err := http.NewRequest("GET", url.String(), nil)
-	if err != nil {
+// Parse argument, return nut identifier and requested version (nil if not requested).
+// Identifier is import path for names and import paths, and URL for URLs (without version in both cases).
+// It may be passed to ParseArg again.
+func NutIdentifier(s string) (id string, version *Version) {
+	u, prefix := ParseArg(s)
+	if strings.HasSuffix(u.Path, ".nut") {
+		id = u.String()
 		return
 	}
-	req.Header.Set("User-Agent", "nut getter")
-	req.Header.Set("Accept", "application/zip")
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return
+	path := strings.TrimSuffix(u.Path, "/")
+	if VersionRequested(u) {
+		i := strings.LastIndex(path, "/")
+		version, _ = NewVersion(path[i+1:])
+		path = path[:i]
 	}
-	defer res.Body.Close()
 
-	b, err = ioutil.ReadAll(res.Body)
-	if err != nil {
-		return
+	if strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
+		u.Path = path
+		id = u.String()
+	} else {
+		// strip path of registry base URL
+		if base, err := url.Parse(NutImportPrefixes[prefix]); err == nil {
+			path = strings.TrimPrefix(path, base.Path)
+		}
+		id = prefix + path
+	}
+	return
+}
+
+// Implements Registry with ParseArg and registry clients.
+type httpRegistry struct {
+	verbose bool
+	clients map[string]*registry.Client // by import prefix
+}
+
+func newHTTPRegistry(verbose bool) *httpRegistry {
+	return &httpRegistry{verbose: verbose, clients: make(map[string]*registry.Client)}
+}
+
+// Returns client for registry serving URL, or client without base URL for unknown registry.
+func (r *httpRegistry) client(u *url.URL) (c *registry.Client, err error) {
+	prefix := registryPrefix(u.String())
+	c = r.clients[prefix]
+	if c == nil {
+		c, err = RegistryClient(prefix, r.verbose)
+		if err != nil {
+			return
+		}
+		r.clients[prefix] = c
 	}
+	return
+}
+
+func (*httpRegistry) Resolve(id string) (u *url.URL, prefix string, err error) {
+	u, prefix = ParseArg(id)
+	return
+}
 
-	if res.StatusCode/100 != 2 {
-		err = fmt.Errorf("Status code %d", res.StatusCode)
+func (r *httpRegistry) Versions(u *url.URL) (versions []*Version, err error) {
+	c, err := r.client(u)
+	if err != nil {
 		return
 	}
+	versions, err = c.VersionsAt(u)
 
-	if getV {
-		log.Printf("Status code %d", res.StatusCode)
+	// registry may serve nut files without listing versions
+	var notFound *registry.NotFoundError
+	var parse *registry.ParseError
+	var re *registry.ResponseError
+	if errors.As(err, &notFound) || errors.As(err, &parse) ||
+		(errors.As(err, &re) && (re.StatusCode == http.StatusMethodNotAllowed || re.StatusCode == http.StatusNotAcceptable)) {
+		err = fmt.Errorf("%s (%w)", err, ErrVersionsNotListed)
 	}
-
 	return
 }
 
+func (r *httpRegistry) Download(u *url.URL) (rc io.ReadCloser, err error) {
+	c, err := r.client(u)
+	if err != nil {
+		return
+	}
+	return c.Open(u, "application/zip")
+}
+
 func runGet(cmd *Command) {
 	if !getV {
 		getV = Config.V
 	}
+	if !getSigned {
+		getSigned = Config.RequireSigned
+	}
 
 	args := cmd.Flag.Args()
+	roots := make(map[string]*Constraint, len(args))
+	in := NewInstaller(getP, getSigned, getNC, getV)
+	writeLock := false
 
 	// zero arguments is a special case – install dependencies for package in current directory
 	if len(args) == 0 {
+		// use versions from lock file if it exists
+		lock := new(Lock)
+		err := lock.ReadFile(LockFileName)
+		switch {
+		case os.IsNotExist(err):
+			writeLock = true
+		case err != nil:
+			FatalIfErr(err)
+		case getUpdate:
+			writeLock = true
+		default:
+			if getV {
+				log.Printf("Using versions from %s.", LockFileName)
+			}
+			in.Lock = lock
+		}
+
+		// spec is optional there
+		spec := new(Spec)
+		err = spec.ReadFile(SpecFileName)
+		if err != nil && !os.IsNotExist(err) {
+			FatalIfErr(err)
+		}
+
 		pack, err := build.ImportDir(".", 0)
 		FatalIfErr(err)
-		args = NutImports(pack.Imports)
+		nut := Nut{Spec: *spec, Package: *pack}
+		nut.Subpackages, err = ImportSubpackages(&build.Default, ".")
+		FatalIfErr(err)
+		args = NutImports(nut.ExternalImports())
 		if getV && len(args) != 0 {
 			log.Printf("%s depends on nuts: %s", pack.Name, strings.Join(args, ","))
 		}
-	}
-
-	urlsToPaths := make(map[string]string, len(args))
-	for len(args) != 0 {
-		arg := args[0]
-		args = args[1:]
 
-		url, prefix := ParseArg(arg)
-
-		// do not download twice
-		_, present := urlsToPaths[url.String()]
-		if present {
-			continue
+		for _, arg := range args {
+			id, _ := NutIdentifier(arg)
+			roots[id], err = spec.DependencyConstraint(arg)
+			FatalIfErr(err)
+		}
+	} else {
+		if getUpdate {
+			log.Fatal("-update can't be used with arguments.")
 		}
 
-		b, err := get(url)
-		if err != nil {
-			log.Print(err)
+		for _, arg := range args {
+			id, version := NutIdentifier(arg)
 
-			var body map[string]interface{}
-			err = json.Unmarshal(b, &body)
-			if err != nil {
-				log.Print(err)
-			}
-			m, ok := body["Message"]
-			if ok {
-				log.Fatalf("%s", m)
-			} else {
-				log.Fatalf("Response: %#q", body)
+			// URL of nut file is explicit request for its version
+			if version == nil && strings.HasSuffix(id, ".nut") {
+				versions, err := in.Versions(id)
+				FatalIfErr(err)
+				version = versions[0]
 			}
-		}
-
-		nf := new(NutFile)
-		_, err = nf.ReadFrom(bytes.NewReader(b))
-		FatalIfErr(err)
-		deps := NutImports(nf.Imports)
-		if getV && len(deps) != 0 {
-			log.Printf("%s depends on nuts: %s", nf.Name, strings.Join(deps, ", "))
-		}
-		args = append(args, deps...)
 
-		p := getP
-		if p == "" {
-			p = prefix
+			var c *Constraint
+			if version != nil {
+				var err error
+				c, err = NewConstraint("=" + version.String())
+				FatalIfErr(err)
+			}
+			roots[id] = c
 		}
-		fileName := WriteNut(b, p, getV)
-		path := nf.ImportPath(p)
-		UnpackNut(fileName, filepath.Join(SrcDir, path), true, getV)
-		urlsToPaths[url.String()] = path
 	}
 
-	// install in lexical order (useful in integration tests)
-	paths := make([]string, 0, len(urlsToPaths))
-	for _, path := range urlsToPaths {
-		paths = append(paths, path)
+	res, err := in.Get(roots)
+	if err != nil && in.Lock != nil {
+		log.Printf("Can't use versions from %s, use 'nut get -update'.", LockFileName)
+	}
+	FatalIfErr(err)
+	if getV {
+		LogCommands(res)
 	}
-	sort.Strings(paths)
-	for _, path := range paths {
-		InstallPackage(path, getV)
+
+	if writeLock {
+		f, err := os.OpenFile(LockFileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, SpecFilePerm)
+		FatalIfErr(err)
+		defer f.Close()
+		_, err = res.Lock.WriteTo(f)
+		FatalIfErr(err)
+		if getV {
+			log.Printf("%s written.", LockFileName)
+		}
 	}
 }
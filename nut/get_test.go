@@ -1,7 +1,18 @@
 package main_test
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+
 	. "."
+	. "github.com/AlekSi/nut"
 	. "launchpad.net/gocheck"
 )
 
@@ -13,13 +24,15 @@ var _ = Suite(&G{})
 
 func (g *G) SetUpSuite(*C) {
 	g.old = NutImportPrefixes["gonuts.io"]
-	NutImportPrefixes["gonuts.io"] = "server"
-	NutImportPrefixes["express42.com"] = "express42.com"
+	NutImportPrefixes["gonuts.io"] = "http://server"
+	NutImportPrefixes["express42.com"] = "http://express42.com"
+	NutImportPrefixes["nuts.example.com"] = "https://registry.example.org/nuts"
 }
 
 func (g *G) TearDownSuite(*C) {
 	NutImportPrefixes["gonuts.io"] = g.old
 	delete(NutImportPrefixes, "express42.com")
+	delete(NutImportPrefixes, "nuts.example.com")
 }
 
 func (*G) TestParseArg(c *C) {
@@ -33,6 +46,7 @@ func (*G) TestParseArg(c *C) {
 		{"gonuts.io/aleksi/test_nut1/0.0.1", "http://server/aleksi/test_nut1/0.0.1", "gonuts.io"},
 		{"express42.com/nuts/aleksi/test_nut1", "http://express42.com/nuts/aleksi/test_nut1", "express42.com"},
 		{"express42.com/nuts/aleksi/test_nut1/0.0.1", "http://express42.com/nuts/aleksi/test_nut1/0.0.1", "express42.com"},
+		{"nuts.example.com/aleksi/test_nut1/0.0.1", "https://registry.example.org/nuts/aleksi/test_nut1/0.0.1", "nuts.example.com"},
 
 		// full URL - as is
 		{"http://www.gonuts.io/aleksi/test_nut1", "http://www.gonuts.io/aleksi/test_nut1", "gonuts.io"},
@@ -40,6 +54,8 @@ func (*G) TestParseArg(c *C) {
 		{"http://localhost:8080/aleksi/test_nut1-0.0.1.nut", "http://localhost:8080/aleksi/test_nut1-0.0.1.nut", "localhost"},
 		{"http://example.com/nuts/test_nut1-0.0.1.nut", "http://example.com/nuts/test_nut1-0.0.1.nut", "example.com"},
 		{"https://example.com/nuts/test_nut1-0.0.1.nut", "https://example.com/nuts/test_nut1-0.0.1.nut", "example.com"},
+		{"https://registry.example.org/nuts/test_nut1-0.0.1.nut", "https://registry.example.org/nuts/test_nut1-0.0.1.nut", "nuts.example.com"},
+		{"http://server/aleksi/test_nut1", "http://server/aleksi/test_nut1", "gonuts.io"},
 	}
 
 	for _, d := range data {
@@ -47,9 +63,219 @@ func (*G) TestParseArg(c *C) {
 		c.Check(u.String(), Equals, d[1])
 		c.Check(prefix, Equals, d[2])
 	}
+
+	// short style with other default registry
+	old := DefaultRegistry
+	DefaultRegistry = "nuts.example.com"
+	defer func() { DefaultRegistry = old }()
+	u, prefix := ParseArg("aleksi/test_nut1")
+	c.Check(u.String(), Equals, "https://registry.example.org/nuts/aleksi/test_nut1")
+	c.Check(prefix, Equals, "nuts.example.com")
+	id, _ := NutIdentifier("aleksi/test_nut1/0.0.1")
+	c.Check(id, Equals, "nuts.example.com/aleksi/test_nut1")
+}
+
+func (*G) TestRegistryToken(c *C) {
+	old := Config
+	defer func() { Config = old }()
+
+	token := func(prefix string) string {
+		t, err := RegistryToken(prefix)
+		c.Check(err, IsNil)
+		return t
+	}
+
+	Config = ConfigFile{Token: "gonuts", Registries: map[string]*RegistryConfig{
+		"nuts.example.com": {URL: "https://registry.example.org/nuts", Token: "example"},
+		"express42.com":    {URL: "http://express42.com"},
+	}}
+	c.Check(token("gonuts.io"), Equals, "gonuts")
+	c.Check(token("nuts.example.com"), Equals, "example")
+	c.Check(token("express42.com"), Equals, "")
+	c.Check(token("unknown"), Equals, "")
+
+	// environment variables
+	c.Check(TokenEnv("nuts.example.com"), Equals, "NUT_TOKEN_NUTS_EXAMPLE_COM")
+	c.Assert(os.Setenv("NUT_TOKEN_NUTS_EXAMPLE_COM", "example-env"), IsNil)
+	c.Check(token("nuts.example.com"), Equals, "example-env")
+	c.Assert(os.Unsetenv("NUT_TOKEN_NUTS_EXAMPLE_COM"), IsNil)
+
+	// NUT_TOKEN overrides config, but only for DefaultRegistry
+	c.Assert(os.Setenv("NUT_TOKEN", "env"), IsNil)
+	c.Check(token("gonuts.io"), Equals, "env")
+	c.Check(token("nuts.example.com"), Equals, "example")
+	c.Check(token("express42.com"), Equals, "")
+	c.Assert(os.Unsetenv("NUT_TOKEN"), IsNil)
+
+	// credential helpers
+	if runtime.GOOS == "windows" {
+		c.Skip("shell script")
+	}
+	dir := c.MkDir()
+	helper := filepath.Join(dir, "helper.sh")
+	c.Assert(ioutil.WriteFile(helper, []byte("#!/bin/sh\necho \"$1-$2-$3\"\n"), 0755), IsNil)
+	failing := filepath.Join(dir, "failing.sh")
+	c.Assert(ioutil.WriteFile(failing, []byte("#!/bin/sh\necho 'no token' >&2\nexit 1\n"), 0755), IsNil)
+	Config.CredentialHelper = helper
+	Config.Registries["express42.com"].CredentialHelper = failing
+	c.Check(token("nuts.example.com"), Equals, "example")
+	c.Check(token("gonuts.io"), Equals, "gonuts")
+	Config.Token = ""
+	c.Check(token("gonuts.io"), Equals, "get-gonuts.io-http://server")
+	c.Assert(os.Setenv("NUT_TOKEN", "env"), IsNil)
+	c.Check(token("gonuts.io"), Equals, "env")
+	c.Check(token("nuts.example.com"), Equals, "example")
+	c.Assert(os.Unsetenv("NUT_TOKEN"), IsNil)
+	_, err := RegistryToken("express42.com")
+	c.Check(err, ErrorMatches, `Credential helper .+/failing.sh failed: exit status 1\nno token`)
+}
+
+func (*G) TestRegisterConfigCheckers(c *C) {
+	n := len(Checkers())
+	ec := &ExecChecker{Path: "/bin/true", Rules: Rules{"config-checker": SeverityWarning}}
+	errors := RegisterConfigCheckers([]*ExecChecker{
+		nil,
+		{Rules: Rules{"config-no-path": SeverityError}},
+		{Path: "/bin/false", Rules: Rules{RuleLicense: SeverityOff}},
+		ec,
+		{Path: "/bin/true", Rules: Rules{"config-checker": SeverityError}},
+	})
+	c.Assert(errors, HasLen, 4)
+	c.Check(errors[0], ErrorMatches, `Skipping checker #1: no Path given.`)
+	c.Check(errors[1], ErrorMatches, `Skipping checker #2: no Path given.`)
+	c.Check(errors[2], ErrorMatches, `Skipping checker /bin/false: rule "license" is already registered.`)
+	c.Check(errors[3], ErrorMatches, `Skipping checker /bin/true: rule "config-checker" is already registered.`)
+	c.Check(Checkers(), HasLen, n+1)
+	c.Check(DefaultRules[RuleLicense], Equals, SeverityError)
+	c.Check(DefaultRules["config-checker"], Equals, SeverityWarning)
+	_, ok := DefaultRules["config-no-path"]
+	c.Check(ok, Equals, false)
+}
+
+func (*G) TestVersionRequested(c *C) {
+	data := map[string]bool{
+		"aleksi/test_nut1":                                 false,
+		"aleksi/test_nut1/":                                false,
+		"aleksi/test_nut1/0.0.1":                           true,
+		"aleksi/test_nut1/0.1.0-rc.1":                      true,
+		"gonuts.io/aleksi/test_nut1/0.1.0-rc.1+build.2":    true,
+		"http://localhost:8080/aleksi/test_nut1-0.0.1.nut": true,
+	}
+
+	for arg, expected := range data {
+		u, _ := ParseArg(arg)
+		c.Check(VersionRequested(u), Equals, expected, Commentf("%s", arg))
+	}
+}
+
+func (*G) TestRequestedNut(c *C) {
+	data := [][4]string{
+		{"aleksi/test_nut1", "aleksi", "test_nut1", ""},
+		{"aleksi/test_nut1/0.0.1", "aleksi", "test_nut1", "0.0.1"},
+		{"gonuts.io/aleksi/test_nut1/0.1.0-rc.1/", "aleksi", "test_nut1", "0.1.0-rc.1"},
+		{"express42.com/nuts/aleksi/test_nut1", "aleksi", "test_nut1", ""},
+		{"http://localhost:8080/aleksi/test_nut1-0.0.1.nut", "", "test_nut1", "0.0.1"},
+		{"http://example.com/test_nut1-0.1.0-rc.1.nut", "", "test_nut1", "0.1.0-rc.1"},
+	}
+
+	for _, d := range data {
+		u, _ := ParseArg(d[0])
+		vendor, name, version := RequestedNut(u)
+		c.Check(vendor, Equals, d[1])
+		c.Check(name, Equals, d[2])
+		if d[3] == "" {
+			c.Check(version, IsNil)
+		} else {
+			c.Check(version.String(), Equals, d[3])
+		}
+	}
+}
+
+func (*G) TestNutIdentifier(c *C) {
+	data := [][3]string{
+		{"aleksi/test_nut1", "gonuts.io/aleksi/test_nut1", ""},
+		{"aleksi/test_nut1/0.0.1", "gonuts.io/aleksi/test_nut1", "0.0.1"},
+		{"gonuts.io/aleksi/test_nut1/0.1.0-rc.1", "gonuts.io/aleksi/test_nut1", "0.1.0-rc.1"},
+		{"express42.com/nuts/aleksi/test_nut1/", "express42.com/nuts/aleksi/test_nut1", ""},
+		{"http://www.gonuts.io/aleksi/test_nut1/0.0.1", "http://www.gonuts.io/aleksi/test_nut1", "0.0.1"},
+		{"http://localhost:8080/aleksi/test_nut1-0.0.1.nut", "http://localhost:8080/aleksi/test_nut1-0.0.1.nut", ""},
+	}
+
+	for _, d := range data {
+		id, version := NutIdentifier(d[0])
+		c.Check(id, Equals, d[1])
+		if d[2] == "" {
+			c.Check(version, IsNil)
+		} else {
+			c.Check(version.String(), Equals, d[2])
+		}
+
+		// identifier may be parsed again
+		id2, version := NutIdentifier(id)
+		c.Check(id2, Equals, id)
+		c.Check(version, IsNil)
+	}
+}
+
+func (*G) TestRegistryVersions(c *C) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Header.Get("Accept"), Equals, "application/json")
+		switch r.URL.Path {
+		case "/debug/test_nut1":
+		case "/debug/test_nut3":
+			fmt.Fprint(w, "not JSON")
+			return
+		case "/debug/test_nut4":
+			w.WriteHeader(401)
+			fmt.Fprint(w, `{"Message": "Invalid token."}`)
+			return
+		default:
+			w.WriteHeader(404)
+			fmt.Fprint(w, `{"Message": "Nut debug/test_nut2 not found."}`)
+			return
+		}
+		fmt.Fprint(w, `{"Versions": ["0.0.1", "0.1.0", "0.2.0-rc.1"]}`)
+	}))
+	defer server.Close()
+	old := http.DefaultClient
+	http.DefaultClient = server.Client()
+	defer func() { http.DefaultClient = old }()
+
+	registry := NewInstaller("", false, false, false).Registry
+	u, err := url.Parse(server.URL + "/debug/test_nut1")
+	c.Assert(err, IsNil)
+	versions, err := registry.Versions(u)
+	c.Assert(err, IsNil)
+	c.Check(versions, DeepEquals, []*Version{{Patch: 1}, {Minor: 1}, {Minor: 2, PreRelease: "rc.1"}})
+
+	u.Path = "/debug/test_nut2"
+	_, err = registry.Versions(u)
+	c.Check(err, ErrorMatches, `https://.+/debug/test_nut2: Nut debug/test_nut2 not found. \(Registry doesn't list versions.\)`)
+	c.Check(errors.Is(err, ErrVersionsNotListed), Equals, true)
+	u.Path = "/debug/test_nut3"
+	_, err = registry.Versions(u)
+	c.Check(errors.Is(err, ErrVersionsNotListed), Equals, true)
+	u.Path = "/debug/test_nut4"
+	_, err = registry.Versions(u)
+	c.Check(err, ErrorMatches, `https://.+/debug/test_nut4: Invalid token.`)
+	c.Check(errors.Is(err, ErrVersionsNotListed), Equals, false)
+	u.Path = "/debug/test_nut2"
+
+	// plain HTTP is allowed only for insecure registries
+	u.Scheme = "http"
+	_, err = registry.Versions(u)
+	c.Check(err, ErrorMatches, `Refusing to use insecure URL http://.+/debug/test_nut2: plain HTTP is allowed only for insecure registries.`)
 }
 
 func (*G) TestNutImports(c *C) {
 	actual := NutImports([]string{"fmt", "log/syslog", "github.com/aleksi/nut", "gonuts.io/aleksi/test_nut1"})
 	c.Check(actual, DeepEquals, []string{"gonuts.io/aleksi/test_nut1"})
+
+	// packages in nut subdirectories
+	actual = NutImports([]string{"gonuts.io/aleksi/lib/sub", "gonuts.io/aleksi/lib", "gonuts.io/aleksi/lib/sub/inner", "gonuts.io/aleksi/other/sub"})
+	c.Check(actual, DeepEquals, []string{"gonuts.io/aleksi/lib", "gonuts.io/aleksi/other"})
+
+	// configured registries
+	actual = NutImports([]string{"nuts.example.com/aleksi/lib/sub", "example.com/aleksi/lib"})
+	c.Check(actual, DeepEquals, []string{"nuts.example.com/aleksi/lib"})
 }
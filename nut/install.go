@@ -1,33 +1,27 @@
 package main
 
-import (
-	"io/ioutil"
-	"log"
-	"os"
-	"path/filepath"
-)
-
-const (
-	WorkspaceDirPerm = 0755
-)
-
 var (
 	cmdInstall = &Command{
 		Run:       runInstall,
-		UsageLine: "install [-nc] [-p prefix] [-v] [filenames]",
+		UsageLine: "install [-nc] [-p prefix] [-signed] [-v] [filenames]",
 		Short:     "unpack nut and install package",
 	}
 
-	installNC bool
-	installP  string
-	installV  bool
+	installNC     bool
+	installP      string
+	installSigned bool
+	installV      bool
 )
 
 func init() {
 	cmdInstall.Long = `
 Copies nuts into GOPATH/nut/<prefix>/<vendor>/<name>-<version>.nut,
 unpacks them into GOPATH/src/<prefix>/<vendor>/<name> and
-installs using 'go install'.
+installs using 'go install'. Packages in nut subdirectories are installed too;
+imports of packages in nut are rewritten to <prefix>/<vendor>/<name>/<dir>.
+Binary nuts (package main) are installed into GOPATH/bin/<command>.
+Signatures of signed nuts are always checked; with -signed unsigned nuts and
+nuts signed with keys not listed in TrustedKeys in ~/.nut.json are refused.
 
 Examples:
     nut install test_nut1-0.0.1.nut
@@ -36,6 +30,7 @@ Examples:
 
 	cmdInstall.Flag.BoolVar(&installNC, "nc", false, "no check (not recommended)")
 	cmdInstall.Flag.StringVar(&installP, "p", "localhost", "install prefix in workspace")
+	cmdInstall.Flag.BoolVar(&installSigned, "signed", false, signedHelp)
 	cmdInstall.Flag.BoolVar(&installV, "v", false, vHelp)
 }
 
@@ -43,40 +38,16 @@ func runInstall(cmd *Command) {
 	if !installV {
 		installV = Config.V
 	}
+	if !installSigned {
+		installSigned = Config.RequireSigned
+	}
 
+	in := NewInstaller(installP, installSigned, installNC, installV)
 	for _, arg := range cmd.Flag.Args() {
-		b, nf := ReadNut(arg)
-
-		if nf.Name == "main" {
-			log.Fatal(`Binaries (package "main") are not supported yet.`)
-		}
-
-		// check nut
-		if !installNC {
-			errors := nf.Check()
-			if len(errors) != 0 {
-				log.Print("Found errors:")
-				for _, e := range errors {
-					log.Printf("    %s", e)
-				}
-				log.Fatal("Please contact nut author.")
-			}
-		}
-
-		// copy nut
-		dstFile := filepath.Join(NutDir, nf.FilePath(installP))
+		res, err := in.InstallFile(arg)
+		FatalIfErr(err)
 		if installV {
-			log.Printf("Copying %s to %s ...", arg, dstFile)
+			LogCommands(res)
 		}
-		FatalIfErr(os.MkdirAll(filepath.Dir(dstFile), WorkspaceDirPerm))
-		FatalIfErr(ioutil.WriteFile(dstFile, b, NutFilePerm))
-
-		srcPath := filepath.Join(SrcDir, nf.ImportPath(installP))
-		if installV {
-			log.Printf("Unpacking into %s ...", srcPath)
-		}
-		UnpackNut(dstFile, srcPath, true, installV)
-
-		InstallPackage(nf.ImportPath(installP), installV)
 	}
 }
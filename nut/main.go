@@ -7,6 +7,8 @@ import (
 	"os"
 	"strings"
 	"text/template"
+
+	. "github.com/AlekSi/nut"
 )
 
 // A Command is an implementation of a nut command like nut get or nut install.
@@ -48,10 +50,12 @@ func (c *Command) Usage() {
 
 // Commands lists the available commands.
 // The order here is the order in which they are printed by 'nut help'.
-var Commands = []*Command{cmdCheck, cmdGenerate, cmdGet, cmdInstall, cmdPack, cmdPublish, cmdUnpack}
+var Commands = []*Command{cmdCheck, cmdGenerate, cmdGet, cmdInstall, cmdPack, cmdPublish, cmdServe, cmdSign, cmdUnpack}
 
-var usageTemplate = template.Must(template.New("top").Parse(`Nut is a tool for managing versioned Go source code packages.
-Version 0.3.dev.
+var usageTemplate = template.Must(template.New("top").Funcs(template.FuncMap{
+	"version": func() string { return NutVersion },
+}).Parse(`Nut is a tool for managing versioned Go source code packages.
+Version {{version}}.
 
 Usage:
 
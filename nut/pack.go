@@ -1,8 +1,12 @@
 package main
 
 import (
-	"go/build"
+	"bytes"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 
 	. "github.com/AlekSi/nut"
 )
@@ -14,26 +18,59 @@ const (
 var (
 	cmdPack = &Command{
 		Run:       runPack,
-		UsageLine: "pack [-nc] [-o filename] [-v]",
+		UsageLine: "pack [-n] [-nc] [-o filename] [-v] [-verify filename]",
 		Short:     "pack package in current directory into nut",
 	}
 
-	packNC bool
-	packO  string
-	packV  bool
+	packN      bool
+	packNC     bool
+	packO      string
+	packV      bool
+	packVerify string
 )
 
 func init() {
 	cmdPack.Long = `
-Packs package in current directory into nut.
+Packs package in current directory and packages in its subdirectories
+(except testdata and directories starting with "." or "_") into nut.
+All source files are packed (Go, cgo, C, C++, assembly, headers, SWIG,
+syso and others, including files for other platforms), together with
+testdata directories, files matched by //go:embed patterns and ExtraFiles.
+ExtraFiles in nut.json may contain file and directory names (directories
+are packed recursively) and glob patterns with "*", "?", "[...]" and "**"
+(any number of directories), e.g. "docs/**/*.md".
+
+Files matching rules in .nutignore file in current directory are not
+packed (except nut.json). It has the same syntax as .gitignore:
+"#" for comments, "!" to include file again, "/" at the end to match
+only directories, "/" at the beginning or in the middle to match path
+relative to nut root instead of file name at any level.
+
+With -n, prints files to be packed and their sizes, but does not pack them.
+Packages in nut may import each other with local imports ("./sub") or
+with import path of nut ("gonuts.io/vendor/name/sub"); those imports are
+rewritten on install.
+Binary nut (package main) should have command name in Command field of
+nut.json; it is used as nut name.
+
+Packing is reproducible: files are sorted, their modification times,
+modes and compression level are normalized, so nuts packed from the same
+files by the same Go version are byte-identical (compression may differ
+between Go versions). With -verify, package is packed into temporary file
+and compared with given nut (signature of given nut is ignored);
+no nut is created.
 
 Examples:
     nut pack
+    nut pack -n
+    nut pack -verify test_nut1-0.0.1.nut
 `
 
+	cmdPack.Flag.BoolVar(&packN, "n", false, "print files and their sizes, but do not pack them")
 	cmdPack.Flag.BoolVar(&packNC, "nc", false, "no check (not recommended)")
 	cmdPack.Flag.StringVar(&packO, "o", "", "output filename")
 	cmdPack.Flag.BoolVar(&packV, "v", false, vHelp)
+	cmdPack.Flag.StringVar(&packVerify, "verify", "", "compare packed nut with given nut instead of writing it")
 }
 
 func runPack(cmd *Command) {
@@ -44,30 +81,16 @@ func runPack(cmd *Command) {
 	if len(cmd.Flag.Args()) != 0 {
 		log.Fatal("This command does not accept arguments.")
 	}
-
-	/*
-		packages := build.ImportDir(".", 0)
-		if len(packages) > 1 {
-			panic(fmt.Errorf("Multi-package nuts are not supported yet\n%#v", packages))
-			// implementation will require import overwrites on install to prevent error like
-			// "local import "./dir/subdir" in non-local package"
-		}
-	*/
-
-	ctxt := build.Default
-	ctxt.UseAllFiles = true
-	pack, err := ctxt.ImportDir(".", 0)
-	FatalIfErr(err)
-
-	if pack.Name == "main" {
-		log.Fatal(`Binaries (package "main") are not supported yet.`)
+	if packN && packVerify != "" {
+		log.Fatal("-n and -verify can't be used together.")
 	}
 
 	var fileName string
 	spec := new(Spec)
-	err = spec.ReadFile(SpecFileName)
+	err := spec.ReadFile(SpecFileName)
+	FatalIfErr(err)
+	nut, files, err := PackFiles(".", spec)
 	FatalIfErr(err)
-	nut := Nut{Spec: *spec, Package: *pack}
 	if packO == "" {
 		fileName = nut.FileName()
 	} else {
@@ -75,7 +98,7 @@ func runPack(cmd *Command) {
 	}
 
 	if !packNC {
-		errors := nut.Check()
+		errors := CheckFindings(nut.Findings(), "")
 		if len(errors) != 0 {
 			log.Print("Found errors:")
 			for _, e := range errors {
@@ -85,16 +108,84 @@ func runPack(cmd *Command) {
 		}
 	}
 
-	var files []string
-	files = append(files, pack.GoFiles...)
-	files = append(files, pack.CgoFiles...)
-	files = append(files, pack.TestGoFiles...)
-	files = append(files, pack.XTestGoFiles...)
-	files = append(files, spec.ExtraFiles...)
-	files = append(files, SpecFileName)
+	if packN {
+		var total int64
+		for _, file := range files {
+			fi, err := os.Stat(filepath.FromSlash(file))
+			FatalIfErr(err)
+			fmt.Printf("%10d %s\n", fi.Size(), file)
+			total += fi.Size()
+		}
+		fmt.Printf("%10d total in %d files\n", total, len(files))
+		return
+	}
+
+	if packVerify != "" {
+		dir, err := ioutil.TempDir("", "nut-")
+		FatalIfErr(err)
+		fileName = filepath.Join(dir, nut.FileName())
+		PackNut(fileName, files, packV)
+		err = VerifyPacked(fileName, packVerify)
+		FatalIfErr(os.RemoveAll(dir))
+		FatalIfErr(err)
+		log.Printf("%s is identical to packed nut.", packVerify)
+		return
+	}
 
 	PackNut(fileName, files, packV)
 	if packV {
 		log.Printf("%s created.", fileName)
 	}
 }
+
+// Checks that nut in file other is byte-identical to packed nut, ignoring signature of other.
+func VerifyPacked(packed, other string) (err error) {
+	b1, err := ioutil.ReadFile(packed)
+	if err != nil {
+		return
+	}
+	b2, err := ioutil.ReadFile(other)
+	if err != nil {
+		return
+	}
+
+	nf2 := new(NutFile)
+	_, err = nf2.ReadFrom(bytes.NewReader(b2))
+	if err != nil {
+		return
+	}
+	if _, err = nf2.Signature(); err == nil {
+		buf := new(bytes.Buffer)
+		err = nf2.WriteUnsigned(buf)
+		if err != nil {
+			return
+		}
+		b2 = buf.Bytes()
+	} else if err != ErrNotSigned {
+		return
+	}
+	err = nil
+
+	if bytes.Equal(b1, b2) {
+		return
+	}
+
+	// find first difference to help user
+	nf1 := new(NutFile)
+	_, err = nf1.ReadFrom(bytes.NewReader(b1))
+	if err != nil {
+		return
+	}
+	files1, files2 := nf1.Reader.File, nf2.Reader.File
+	for i := 0; i < len(files1) || i < len(files2); i++ {
+		switch {
+		case i >= len(files1):
+			return fmt.Errorf("%s differs from packed nut: extra file %q.", other, files2[i].Name)
+		case i >= len(files2) || files1[i].Name != files2[i].Name:
+			return fmt.Errorf("%s differs from packed nut: missing file %q.", other, files1[i].Name)
+		case files1[i].CRC32 != files2[i].CRC32 || files1[i].UncompressedSize64 != files2[i].UncompressedSize64:
+			return fmt.Errorf("%s differs from packed nut: file %q has different content.", other, files1[i].Name)
+		}
+	}
+	return fmt.Errorf("%s differs from packed nut: files are the same, but metadata or compression differ.", other)
+}
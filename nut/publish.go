@@ -1,86 +1,80 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"net/url"
+
+	"github.com/AlekSi/nut/registry"
 )
 
 var (
 	cmdPublish = &Command{
 		Run:       runPublish,
-		UsageLine: "publish [-token token] [-v] [filename]",
-		Short:     "publish nut on gonuts.io",
+		UsageLine: "publish [-p prefix] [-token token] [-v] [filename]",
+		Short:     "publish nut on gonuts.io or other registry",
 	}
 
+	publishP     string
 	publishToken string
 	publishV     bool
 )
 
 func init() {
 	cmdPublish.Long = `
-Publishes nut on http://gonuts.io/ (requires registration with Google account).
+Publishes nut on http://gonuts.io/ (requires registration with Google account)
+or other registry from Registries in ~/.nut.json (see 'nut serve').
+By default nut is published on DefaultRegistry (gonuts.io if not set).
+Access token is sent in "Authorization: Bearer" header. If -token is not given,
+it is read from NUT_TOKEN_<PREFIX> environment variable (prefix in upper case
+with other characters replaced by "_", e.g. NUT_TOKEN_NUTS_EXAMPLE_COM),
+NUT_TOKEN environment variable (for DefaultRegistry only), Token of registry entry
+in ~/.nut.json (or Token for gonuts.io), or printed by credential helper executable
+(CredentialHelper of registry entry or in ~/.nut.json), which is run as
+"<helper> get <prefix> <registry URL>". That way token doesn't have to be stored
+in ~/.nut.json. Environment variables take precedence over ~/.nut.json.
 
 Examples:
     nut publish test_nut1-0.0.1.nut
+    nut publish -p nuts.example.com test_nut1-0.0.1.nut
+    NUT_TOKEN=secret nut publish test_nut1-0.0.1.nut
+    NUT_TOKEN_NUTS_EXAMPLE_COM=secret nut publish -p nuts.example.com test_nut1-0.0.1.nut
 `
 
-	tokenHelp := fmt.Sprintf("access token from http://gonuts.io/-/me (may be read from ~/%s)", ConfigFileName)
+	tokenHelp := fmt.Sprintf("access token from http://gonuts.io/-/me or other registry (may be read from NUT_TOKEN_<PREFIX>, NUT_TOKEN or ~/%s)", ConfigFileName)
+	cmdPublish.Flag.StringVar(&publishP, "p", "", "import prefix of registry (DefaultRegistry if omitted)")
 	cmdPublish.Flag.StringVar(&publishToken, "token", "", tokenHelp)
 	cmdPublish.Flag.BoolVar(&publishV, "v", false, vHelp)
 }
 
 func runPublish(cmd *Command) {
-	if publishToken == "" {
-		publishToken = Config.Token
+	if publishP == "" {
+		publishP = DefaultRegistry
 	}
 	if !publishV {
 		publishV = Config.V
 	}
 
-	url, err := url.Parse("http://" + NutImportPrefixes["gonuts.io"])
+	client, err := RegistryClient(publishP, false)
 	FatalIfErr(err)
+	if publishToken == "" {
+		publishToken, err = RegistryToken(publishP)
+		FatalIfErr(err)
+	}
+	client.Token = publishToken
 
 	for _, arg := range cmd.Flag.Args() {
 		b, nf := ReadNut(arg)
-		url.Path = fmt.Sprintf("/%s/%s/%s", nf.Vendor, nf.Name, nf.Version)
-
 		if publishV {
-			log.Printf("Putting %s to %s ...", arg, url)
+			log.Printf("Putting %s to %s ...", arg, client.URL(nf.Vendor, nf.NutName(), &nf.Version))
 		}
-		url.RawQuery = "token=" + publishToken
-		req, err := http.NewRequest("PUT", url.String(), bytes.NewReader(b))
-		FatalIfErr(err)
-		req.Header.Set("User-Agent", "nut publisher")
-		req.Header.Set("Content-Type", "application/zip")
-		req.ContentLength = int64(len(b))
 
-		res, err := http.DefaultClient.Do(req)
-		FatalIfErr(err)
-		b, err = ioutil.ReadAll(res.Body)
-		FatalIfErr(err)
-		err = res.Body.Close()
-		FatalIfErr(err)
-
-		var body map[string]interface{}
-		err = json.Unmarshal(b, &body)
-		if err != nil {
-			log.Print(err)
-		}
-
-		m, ok := body["Message"]
-		if ok {
-			ok = res.StatusCode/100 == 2
-		} else {
-			m = string(b)
-		}
-		if !ok {
-			log.Fatal(m)
+		m, err := client.Publish(nf.Vendor, nf.NutName(), &nf.Version, b)
+		var re *registry.ResponseError
+		if errors.As(err, &re) && re.Message != "" {
+			log.Fatal(re.Message)
 		}
+		FatalIfErr(err)
 		if publishV {
 			log.Print(m)
 		}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	. "github.com/AlekSi/nut"
+)
+
+var (
+	cmdServe = &Command{
+		Run:       runServe,
+		UsageLine: "serve [-addr address] [-cert file -key file] [-dir directory] [-nc] [-token token] [-v]",
+		Short:     "serve nuts from directory",
+	}
+
+	serveAddr  string
+	serveCert  string
+	serveKey   string
+	serveDir   string
+	serveNC    bool
+	serveToken string
+	serveV     bool
+)
+
+func init() {
+	cmdServe.Long = `
+Runs nut registry serving nuts stored in directory as <dir>/<vendor>/<name>-<version>.nut.
+
+API:
+    GET /<vendor>/<name> returns the latest version;
+    GET /<vendor>/<name>/<version> returns given version;
+    with "Accept: application/json" both return information about version (and
+    list of versions as {"Versions": [...], ...} for the latest one);
+    GET /-/search?q=<query> returns information about found nuts as {"Nuts": [...]};
+    PUT /<vendor>/<name>/<version> with "Authorization: Bearer <token>" header publishes nut.
+
+Published nuts are checked (unless -nc is given) and can't be replaced.
+Publishing is disabled if token is empty. If -token is not given, it is read
+from ServeToken in ~/.nut.json (Token there is client's token for gonuts.io
+and is not used).
+Registry is served over HTTPS if -cert and -key are given, and over plain HTTP otherwise
+(then it should be marked as insecure in client config, or put behind HTTPS proxy).
+Use registry with 'nut get' and 'nut publish' by adding it to Registries in ~/.nut.json:
+    "Registries": {"nuts.example.com": {"URL": "https://nuts.example.com:8080", "Token": "secret"}}
+
+Examples:
+    nut serve -dir /var/nuts -token secret -cert cert.pem -key key.pem
+    nut get nuts.example.com/debug/test_nut1
+`
+
+	cmdServe.Flag.StringVar(&serveAddr, "addr", ":8080", "listen address")
+	cmdServe.Flag.StringVar(&serveCert, "cert", "", "PEM file with TLS certificate")
+	cmdServe.Flag.StringVar(&serveKey, "key", "", "PEM file with TLS certificate key")
+	cmdServe.Flag.StringVar(&serveDir, "dir", ".", "directory with nuts")
+	cmdServe.Flag.BoolVar(&serveNC, "nc", false, "do not check published nuts (not recommended)")
+	cmdServe.Flag.StringVar(&serveToken, "token", "", "token required for publishing (may be read from ServeToken in ~/"+ConfigFileName+")")
+	cmdServe.Flag.BoolVar(&serveV, "v", false, vHelp)
+}
+
+func runServe(cmd *Command) {
+	if serveToken == "" {
+		serveToken = Config.ServeToken
+	}
+	if !serveV {
+		serveV = Config.V
+	}
+
+	s := &Server{Dir: serveDir, Token: serveToken, NoCheck: serveNC, Rules: Config.Rules}
+	if serveV {
+		s.Logf = log.Printf
+		log.Printf("Serving nuts from %s on %s ...", serveDir, serveAddr)
+	}
+	if serveCert != "" || serveKey != "" {
+		log.Fatal(http.ListenAndServeTLS(serveAddr, serveCert, serveKey, s))
+	}
+	log.Fatal(http.ListenAndServe(serveAddr, s))
+}
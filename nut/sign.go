@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	. "github.com/AlekSi/nut"
+)
+
+const (
+	KeyFilePerm = 0600
+)
+
+var (
+	cmdSign = &Command{
+		Run:       runSign,
+		UsageLine: "sign [-genkey] [-key filename] [-v] [filenames]",
+		Short:     "sign nuts with private key",
+	}
+
+	signGenKey bool
+	signKey    string
+	signV      bool
+)
+
+func init() {
+	cmdSign.Long = `
+Signs nuts with ed25519 private key. Signature is stored inside nut in file nut.sig
+and replaces existing one. Public keys of trusted signers should be listed in
+TrustedKeys in ~/.nut.json; use 'nut install -signed' and 'nut get -signed'
+to refuse unsigned and untrusted nuts.
+
+With -genkey generates new key pair, writes private key to given file (which should not exist)
+and prints public key.
+
+Examples:
+    nut sign -genkey -key ~/.nut.key
+    nut sign -key ~/.nut.key test_nut1-0.0.1.nut
+    nut sign test_nut1-0.0.1.nut
+`
+
+	keyHelp := fmt.Sprintf("private key filename (may be read from SigningKey in ~/%s)", ConfigFileName)
+	cmdSign.Flag.BoolVar(&signGenKey, "genkey", false, "generate new key pair")
+	cmdSign.Flag.StringVar(&signKey, "key", "", keyHelp)
+	cmdSign.Flag.BoolVar(&signV, "v", false, vHelp)
+}
+
+func runSign(cmd *Command) {
+	if signKey == "" {
+		signKey = Config.SigningKey
+	}
+	if !signV {
+		signV = Config.V
+	}
+
+	if signKey == "" {
+		log.Fatal("Private key filename is not given.")
+	}
+
+	if signGenKey {
+		if len(cmd.Flag.Args()) != 0 {
+			log.Fatal("-genkey does not accept filenames.")
+		}
+
+		public, private, err := GenerateKey()
+		FatalIfErr(err)
+		f, err := os.OpenFile(signKey, os.O_WRONLY|os.O_CREATE|os.O_EXCL, KeyFilePerm)
+		FatalIfErr(err)
+		_, err = fmt.Fprintln(f, EncodeKey(private))
+		FatalIfErr(err)
+		FatalIfErr(f.Close())
+
+		if signV {
+			log.Printf("Private key written to %s. Add public key to TrustedKeys in ~/%s.", signKey, ConfigFileName)
+		}
+		fmt.Println(EncodeKey(public))
+		return
+	}
+
+	b, err := ioutil.ReadFile(signKey)
+	FatalIfErr(err)
+	key, err := DecodePrivateKey(strings.TrimSpace(string(b)))
+	FatalIfErr(err)
+
+	for _, arg := range cmd.Flag.Args() {
+		_, nf := ReadNut(arg)
+
+		buf := new(bytes.Buffer)
+		FatalIfErr(nf.Sign(key, buf))
+		FatalIfErr(ioutil.WriteFile(arg, buf.Bytes(), NutFilePerm))
+
+		if signV {
+			log.Printf("%s signed.", arg)
+		}
+	}
+}
@@ -18,7 +18,7 @@ var (
 
 func init() {
 	cmdUnpack.Long = `
-Unpacks nut into current directory.
+Unpacks nut into current directory. Files are unpacked as is, without rewriting imports.
 
 Examples:
     nut unpack test_nut1-0.0.1.nut
@@ -40,8 +40,9 @@ func runUnpack(cmd *Command) {
 
 	// check nut
 	if !unpackNC {
-		_, nf := ReadNut(fileName)
-		errors := nf.Check()
+		nf := OpenNut(fileName)
+		errors := CheckFindings(nf.ConsumerFindings(Config.Rules), "")
+		FatalIfErr(nf.Close())
 		if len(errors) != 0 {
 			log.Print("Found errors:")
 			for _, e := range errors {
@@ -54,7 +55,7 @@ func runUnpack(cmd *Command) {
 	// unpack nut
 	dir, err := os.Getwd()
 	FatalIfErr(err)
-	UnpackNut(fileName, dir, false, unpackV)
+	UnpackNut(fileName, dir, "", false, unpackV)
 	if unpackV {
 		log.Printf("%s unpacked.", fileName)
 	}
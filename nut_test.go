@@ -1,7 +1,9 @@
 package nut_test
 
 import (
+	"archive/zip"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -31,6 +33,24 @@ func (f *N) SetUpTest(c *C) {
 	f.nf = nf
 }
 
+func (f *N) TestNutFileOpenFile(c *C) {
+	nf := new(NutFile)
+	c.Assert(nf.OpenFile("../test_nut1/test_nut1-0.0.1.nut"), IsNil)
+	c.Check(nf.Nut, DeepEquals, f.nf.Nut)
+	c.Check(nf.Check(), DeepEquals, f.nf.Check())
+
+	b, err := fs.ReadFile(nf, "README")
+	c.Check(err, IsNil)
+	c.Check(len(b) > 0, Equals, true)
+
+	c.Check(nf.Close(), IsNil)
+	c.Check(nf.Close(), IsNil)
+	_, err = fs.ReadFile(nf, "README")
+	c.Check(err, NotNil)
+
+	c.Check(nf.OpenFile("../test_nut1/missing.nut"), NotNil)
+}
+
 func (f *N) TestNutFileReadFrom(c *C) {
 	c.Check(f.nf.Spec.Version.String(), Equals, "0.0.1")
 	c.Check(f.nf.Version.String(), Equals, "0.0.1")
@@ -43,14 +63,72 @@ func (f *N) TestNutFileReadFrom(c *C) {
 	c.Check(f.nf.Doc, Equals, "Package test_nut1 is used to test nut.")
 	c.Check(f.nf.GoFiles, DeepEquals, []string{"test_nut1.go", fmt.Sprintf("test_nut1_%s.go", runtime.GOOS)})
 
-	c.Check(len(f.nf.Reader.File), Equals, 11)
-	names := make([]string, 0, 11)
+	c.Check(len(f.nf.Reader.File), Equals, 12)
+	names := make([]string, 0, 12)
 	for _, f := range f.nf.Reader.File {
 		names = append(names, f.Name)
 	}
-	c.Check([]string{"test_nut1.go", "test_nut1_darwin.go", "test_nut1_freebsd.go", "test_nut1_linux.go", "test_nut1_netbsd.go",
-		"test_nut1_openbsd.go", "test_nut1_plan9.go", "test_nut1_windows.go", "README", "LICENSE", "nut.json"},
+	c.Check([]string{"LICENSE", "README", "nut.json", "test_nut1.go", "test_nut1_darwin.go", "test_nut1_freebsd.go", "test_nut1_linux.go",
+		"test_nut1_netbsd.go", "test_nut1_openbsd.go", "test_nut1_plan9.go", "test_nut1_windows.go", "nut.manifest"},
 		DeepEquals, names)
+	for _, f := range f.nf.Reader.File {
+		c.Check(f.Modified.Equal(NutFileTime), Equals, true, Commentf("%s: %s", f.Name, f.Modified))
+		c.Check(f.Mode(), Equals, os.FileMode(0644), Commentf("%s", f.Name))
+		c.Check(f.Method, Equals, zip.Deflate, Commentf("%s", f.Name))
+	}
+
+	m, err := f.nf.Manifest()
+	c.Assert(err, IsNil)
+	c.Check(m.FormatVersion, Equals, ManifestFormatVersion)
+	c.Check(m.Files, HasLen, 11)
+	c.Check(m.Files[2].Name, Equals, "nut.json")
+}
+
+func (f *N) TestCheckIdentity(c *C) {
+	v := &Version{Patch: 1}
+	c.Check(f.nf.CheckIdentity("debug", "test_nut1", v), IsNil)
+	c.Check(f.nf.CheckIdentity("", "", nil), IsNil)
+	c.Check(f.nf.CheckIdentity("debug", "test_nut1", &Version{Patch: 1, Build: "b1"}), ErrorMatches, `Expected nut version 0.0.1\+b1, got 0.0.1.`)
+	c.Check(f.nf.CheckIdentity("aleksi", "test_nut1", v), ErrorMatches, `Expected nut vendor "aleksi", got "debug".`)
+	c.Check(f.nf.CheckIdentity("debug", "test_nut2", v), ErrorMatches, `Expected nut name "test_nut2", got "test_nut1".`)
+	c.Check(f.nf.CheckIdentity("debug", "test_nut1", &Version{Patch: 2}), ErrorMatches, `Expected nut version 0.0.2, got 0.0.1.`)
+
+	nut := f.nf.Nut
+	nut.Vendor = "../debug"
+	c.Check(nut.CheckIdentity("", "", nil), ErrorMatches, `Nut has invalid vendor "../debug".`)
+	nut = f.nf.Nut
+	nut.Name = "../../x"
+	c.Check(nut.CheckIdentity("", "", nil), ErrorMatches, `Nut has invalid name "../../x".`)
+}
+
+func (f *N) TestCommand(c *C) {
+	files := map[string]string{
+		"main.go":  "// Tool does nothing.\npackage main\n\nfunc main() {}\n",
+		"LICENSE":  "license",
+		"nut.json": `{"Version": "0.1.0", "Vendor": "debug", "Authors": [{"FullName": "Nutter"}], "ExtraFiles": ["LICENSE"], "Command": "tool"}`,
+	}
+	nf := new(NutFile)
+	_, err := nf.ReadFrom(makeNut(c, files, []string{"LICENSE", "main.go", "nut.json"}, nil))
+	c.Assert(err, IsNil)
+	c.Check(nf.IsCommand(), Equals, true)
+	c.Check(nf.Name, Equals, "main")
+	c.Check(nf.NutName(), Equals, "tool")
+	c.Check(nf.FileName(), Equals, "tool-0.1.0.nut")
+	c.Check(nf.ImportPath("gonuts.io"), Equals, "gonuts.io/debug/tool")
+	c.Check(nf.CheckIdentity("debug", "tool", &Version{Minor: 1}), IsNil)
+	c.Check(nf.Check(), DeepEquals, []string(nil))
+
+	nut := nf.Nut
+	nut.Command = ""
+	c.Check(nut.NutName(), Equals, "main")
+	c.Check(nut.CheckIdentity("", "", nil), ErrorMatches, `Nut has invalid name "main".`)
+	c.Check(nut.Check(), DeepEquals, []string{"Binary nut (package main) should have command name in Command."})
+
+	nut = f.nf.Nut
+	nut.Command = "tool"
+	c.Check(f.nf.IsCommand(), Equals, false)
+	c.Check(nut.NutName(), Equals, "test_nut1")
+	c.Check(nut.Check(), DeepEquals, []string{"Command should be set only for binary nut (package main)."})
 }
 
 func (f *N) TestNutFileReadFile(c *C) {
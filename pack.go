@@ -0,0 +1,264 @@
+package nut
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Writes nut to underlying writer. Files are written on Close in sorted order with normalized headers
+// (see NewFileHeader), followed by manifest, so nuts written from the same files are byte-identical.
+type NutWriter struct {
+	w     io.Writer
+	files map[string][]byte
+}
+
+// Returns new NutWriter writing to w.
+func NewNutWriter(w io.Writer) *NutWriter {
+	return &NutWriter{w: w, files: make(map[string][]byte)}
+}
+
+// Adds file with given slash-separated name and content.
+func (nw *NutWriter) Add(name string, b []byte) error {
+	if err := CheckFileName(name); err != nil {
+		return err
+	}
+	if IsServiceFile(name) {
+		return fmt.Errorf("File name %q is reserved.", name)
+	}
+	if _, ok := nw.files[name]; ok {
+		return fmt.Errorf("File %q is already added.", name)
+	}
+	nw.files[name] = b
+	return nil
+}
+
+// Adds files with given slash-separated names (relative to dir) from directory dir.
+func (nw *NutWriter) AddFiles(dir string, files []string) error {
+	for _, name := range files {
+		b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		if err = nw.Add(name, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes nut to underlying writer. It does not close underlying writer.
+// Nut is checked against MaxFiles, MaxUncompressedSize and MaxNutSize; nothing is written if check fails.
+func (nw *NutWriter) Close() (err error) {
+	names := make([]string, 0, len(nw.files))
+	var total int64
+	for name, b := range nw.files {
+		names = append(names, name)
+		total += int64(len(b))
+	}
+	sort.Strings(names)
+
+	if len(names)+1 > MaxFiles {
+		return fmt.Errorf("Nut contains too many files: %d (max %d).", len(names)+1, MaxFiles)
+	}
+	if total > MaxUncompressedSize {
+		return fmt.Errorf("Nut files are too big: %d bytes uncompressed (max %d).", total, MaxUncompressedSize)
+	}
+
+	buf := new(bytes.Buffer)
+	zw := newZipWriter(buf)
+	manifest := NewManifest()
+	for _, name := range names {
+		var f io.Writer
+		f, err = zw.CreateHeader(NewFileHeader(name))
+		if err != nil {
+			return
+		}
+		_, err = f.Write(nw.files[name])
+		if err != nil {
+			return
+		}
+		manifest.Add(name, nw.files[name])
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return
+	}
+	f, err := zw.CreateHeader(NewFileHeader(ManifestFileName))
+	if err != nil {
+		return
+	}
+	_, err = f.Write(append(b, '\n'))
+	if err != nil {
+		return
+	}
+	err = zw.Close()
+	if err != nil {
+		return
+	}
+
+	if int64(buf.Len()) > MaxNutSize {
+		return fmt.Errorf("Nut is too big: %d bytes (max %d).", buf.Len(), MaxNutSize)
+	}
+	_, err = buf.WriteTo(nw.w)
+	return
+}
+
+// Returns nut in directory dir and sorted slash-separated names (relative to dir) of files to pack:
+// all source files of all packages in nut (see SourceFiles), testdata directories, files matched
+// by //go:embed patterns and Spec.ExtraFiles (see MatchExtraFiles), and spec itself.
+// Packages are read ignoring build constraints, so they include files for all platforms.
+// Files matching rules in <dir>/.nutignore are skipped (see IgnoreRules), except spec.
+// If spec is nil, it is read from <dir>/nut.json.
+func PackFiles(dir string, spec *Spec) (nut *Nut, files []string, err error) {
+	if spec == nil {
+		spec = new(Spec)
+		err = spec.ReadFile(filepath.Join(dir, SpecFileName))
+		if err != nil {
+			return
+		}
+	}
+
+	ctxt := build.Default
+	ctxt.UseAllFiles = true
+	pack, err := ctxt.ImportDir(dir, 0)
+	if err != nil {
+		return
+	}
+	subpackages, err := ImportSubpackages(&ctxt, dir)
+	if err != nil {
+		return
+	}
+	nut = &Nut{Spec: *spec, Package: *pack, Subpackages: subpackages}
+
+	all, err := listFiles(dir)
+	if err != nil {
+		return
+	}
+	for packDir, p := range nut.Packages() {
+		for _, file := range SourceFiles(p) {
+			files = append(files, path.Join(packDir, file))
+		}
+
+		// add testdata and //go:embed targets
+		inPack := filesIn(all, packDir)
+		for _, file := range inPack {
+			if strings.HasPrefix(file, "testdata/") {
+				files = append(files, path.Join(packDir, file))
+			}
+		}
+		for _, pattern := range EmbedPatterns(p) {
+			matched := MatchEmbedPattern(pattern, inPack)
+			if len(matched) == 0 {
+				err = fmt.Errorf("Pattern %q of //go:embed in %s matches no files.", pattern, packDir)
+				return
+			}
+			for _, file := range matched {
+				files = append(files, path.Join(packDir, file))
+			}
+		}
+	}
+
+	// add extra files
+	for _, entry := range spec.ExtraFiles {
+		matched := MatchExtraFiles(entry, all)
+		if len(matched) == 0 {
+			err = fmt.Errorf("ExtraFiles entry %q matches no files.", entry)
+			return
+		}
+		files = append(files, matched...)
+	}
+
+	// skip ignored files, spec is always packed
+	ignore := new(IgnoreRules)
+	err = ignore.ReadFile(filepath.Join(dir, IgnoreFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	err = nil
+	var packed []string
+	for _, file := range files {
+		if !ignore.Ignored(file) {
+			packed = append(packed, file)
+		}
+	}
+	files = sortFiles(append(packed, SpecFileName))
+	return
+}
+
+// Packs nut in directory dir into w. See PackFiles and NutWriter.
+// If spec is nil, it is read from <dir>/nut.json.
+func Pack(dir string, spec *Spec, w io.Writer) (err error) {
+	_, files, err := PackFiles(dir, spec)
+	if err != nil {
+		return
+	}
+
+	nw := NewNutWriter(w)
+	err = nw.AddFiles(dir, files)
+	if err != nil {
+		return
+	}
+	return nw.Close()
+}
+
+// Returns sorted file names without duplicates.
+func sortFiles(files []string) (sorted []string) {
+	sorted = make([]string, 0, len(files))
+	seen := make(map[string]bool, len(files))
+	for _, file := range files {
+		if !seen[file] {
+			seen[file] = true
+			sorted = append(sorted, file)
+		}
+	}
+	sort.Strings(sorted)
+	return
+}
+
+// Returns all regular files in directory and its subdirectories (slash-separated, relative to dir),
+// except version control directories.
+func listFiles(dir string) (files []string, err error) {
+	err = filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch fi.Name() {
+		case ".git", ".hg", ".svn", ".bzr":
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err == nil {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	return
+}
+
+// Returns files in slash-separated directory dir among given files, relative to dir.
+func filesIn(files []string, dir string) (res []string) {
+	if dir == "." {
+		return files
+	}
+	for _, file := range files {
+		if strings.HasPrefix(file, dir+"/") {
+			res = append(res, file[len(dir)+1:])
+		}
+	}
+	return
+}
@@ -0,0 +1,88 @@
+package nut_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	. "."
+	. "launchpad.net/gocheck"
+)
+
+type Pk struct{}
+
+var _ = Suite(&Pk{})
+
+func (*Pk) TestPackFiles(c *C) {
+	nut, files, err := PackFiles("../test_nut1", nil)
+	c.Assert(err, IsNil)
+	c.Check(nut.Name, Equals, "test_nut1")
+	c.Check(nut.Version.String(), Equals, "0.0.1")
+	c.Check(files, DeepEquals, []string{"LICENSE", "README", "nut.json", "test_nut1.go", "test_nut1_darwin.go", "test_nut1_freebsd.go",
+		"test_nut1_linux.go", "test_nut1_netbsd.go", "test_nut1_openbsd.go", "test_nut1_plan9.go", "test_nut1_windows.go"})
+}
+
+func (*Pk) TestPack(c *C) {
+	expected, err := ioutil.ReadFile("../test_nut1/test_nut1-0.0.1.nut")
+	c.Assert(err, IsNil)
+
+	// packing is reproducible
+	buf := new(bytes.Buffer)
+	c.Assert(Pack("../test_nut1", nil, buf), IsNil)
+	c.Check(bytes.Equal(buf.Bytes(), expected), Equals, true)
+
+	spec := new(Spec)
+	c.Assert(spec.ReadFile("../test_nut1/nut.json"), IsNil)
+	spec.ExtraFiles = append(spec.ExtraFiles, "missing")
+	c.Check(Pack("../test_nut1", spec, buf), ErrorMatches, `ExtraFiles entry "missing" matches no files.`)
+}
+
+func (*Pk) TestNutWriter(c *C) {
+	buf := new(bytes.Buffer)
+	nw := NewNutWriter(buf)
+	c.Check(nw.Add("nut.json", []byte(`{"Version": "0.0.1", "Vendor": "debug"}`)), IsNil)
+	c.Check(nw.Add("a.go", []byte("// Package a is used to test nut.\npackage a\n")), IsNil)
+	c.Check(nw.Add("a.go", nil), ErrorMatches, `File "a.go" is already added.`)
+	c.Check(nw.Add("../a.go", nil), ErrorMatches, `File name "../a.go" points outside of nut.`)
+	c.Check(nw.Add(ManifestFileName, nil), ErrorMatches, `File name "nut.manifest" is reserved.`)
+	c.Assert(nw.Close(), IsNil)
+
+	nf := new(NutFile)
+	_, err := nf.ReadFrom(buf)
+	c.Assert(err, IsNil)
+	c.Check(nf.Name, Equals, "a")
+	var names []string
+	for _, f := range nf.Reader.File {
+		names = append(names, f.Name)
+	}
+	c.Check(names, DeepEquals, []string{"a.go", "nut.json", ManifestFileName})
+
+	defer func(old int) { MaxFiles = old }(MaxFiles)
+	MaxFiles = 2
+	nw = NewNutWriter(new(bytes.Buffer))
+	c.Check(nw.Add("a.go", nil), IsNil)
+	c.Check(nw.Add("b.go", nil), IsNil)
+	c.Check(nw.Close(), ErrorMatches, `Nut contains too many files: 3 \(max 2\).`)
+}
+
+func (*Pk) TestNutWriterReproducible(c *C) {
+	write := func() (*bytes.Buffer, error) {
+		buf := new(bytes.Buffer)
+		nw := NewNutWriter(buf)
+		c.Assert(nw.Add("nut.json", []byte(`{"Version": "0.0.1", "Vendor": "debug"}`)), IsNil)
+		c.Assert(nw.Add("a.go", bytes.Repeat([]byte("// Package a is used to test nut.\npackage a\n"), 100)), IsNil)
+		return buf, nw.Close()
+	}
+	buf1, err := write()
+	c.Assert(err, IsNil)
+	buf2, err := write()
+	c.Assert(err, IsNil)
+	c.Check(bytes.Equal(buf1.Bytes(), buf2.Bytes()), Equals, true)
+	c.Check(buf1.Len() < 1000, Equals, true, Commentf("files are not compressed: %d bytes", buf1.Len()))
+
+	defer func(old int64) { MaxNutSize = old }(MaxNutSize)
+	MaxNutSize = int64(buf1.Len() - 1)
+	buf2, err = write()
+	c.Check(err, ErrorMatches, fmt.Sprintf(`Nut is too big: %d bytes \(max %d\).`, buf1.Len(), MaxNutSize))
+	c.Check(buf2.Len(), Equals, 0)
+}
@@ -0,0 +1,272 @@
+package nut
+
+import (
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Returns true if directory with given name is not searched for packages, like in go tool:
+// hidden directories, directories starting with "_", and testdata.
+func skipDir(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata"
+}
+
+// Returns true if Go files in directory with given slash-separated path (relative to nut root)
+// belong to package in nut.
+func isPackageDir(dir string) bool {
+	if dir == "." {
+		return true
+	}
+	for _, name := range strings.Split(dir, "/") {
+		if skipDir(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// Imports package from directory with Go files using given context.
+// Unlike ctxt.ImportDir, package without buildable Go files for this context is not an error;
+// nil is returned if directory contains no Go files at all.
+func importDir(ctxt *build.Context, dir string) (pack *build.Package, err error) {
+	pack, err = ctxt.ImportDir(dir, 0)
+	if _, ok := err.(*build.NoGoError); ok {
+		err = nil
+		if len(pack.IgnoredGoFiles) == 0 {
+			pack = nil
+		}
+	}
+	return
+}
+
+// Imports packages in subdirectories of dir using given context.
+// Returns map from slash-separated directory (relative to dir) to package.
+func ImportSubpackages(ctxt *build.Context, dir string) (packages map[string]*build.Package, err error) {
+	packages = make(map[string]*build.Package)
+	err = filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() || p == dir {
+			return nil
+		}
+		if skipDir(fi.Name()) {
+			return filepath.SkipDir
+		}
+
+		pack, err := importDir(ctxt, p)
+		if err != nil || pack == nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		packages[filepath.ToSlash(rel)] = pack
+		return nil
+	})
+	return
+}
+
+// Returns sorted names of all source files of package: Go files (including tests and files excluded by build
+// constraints), C, C++, Objective-C and Fortran sources, headers, assembly, SWIG and syso files.
+func SourceFiles(pack *build.Package) (files []string) {
+	for _, list := range [][]string{
+		pack.GoFiles, pack.CgoFiles, pack.IgnoredGoFiles, pack.IgnoredOtherFiles,
+		pack.CFiles, pack.CXXFiles, pack.MFiles, pack.HFiles, pack.FFiles, pack.SFiles,
+		pack.SwigFiles, pack.SwigCXXFiles, pack.SysoFiles,
+		pack.TestGoFiles, pack.XTestGoFiles,
+	} {
+		files = append(files, list...)
+	}
+	sort.Strings(files)
+	return
+}
+
+// Returns sorted //go:embed patterns of package and its tests without duplicates.
+func EmbedPatterns(pack *build.Package) (patterns []string) {
+	seen := make(map[string]bool)
+	for _, list := range [][]string{pack.EmbedPatterns, pack.TestEmbedPatterns, pack.XTestEmbedPatterns} {
+		for _, pattern := range list {
+			if !seen[pattern] {
+				seen[pattern] = true
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+	sort.Strings(patterns)
+	return
+}
+
+// Returns files matching //go:embed pattern among given files (slash-separated, relative to package directory),
+// like go tool: if pattern matches directory, all files in it are matched recursively, except files
+// with names starting with "." or "_" (unless pattern has "all:" prefix).
+func MatchEmbedPattern(pattern string, files []string) (matched []string) {
+	all := strings.HasPrefix(pattern, "all:")
+	pattern = strings.TrimPrefix(pattern, "all:")
+
+	for _, file := range files {
+		if ok, _ := path.Match(pattern, file); ok {
+			matched = append(matched, file)
+			continue
+		}
+
+		// check parent directories, skip hidden files and directories below matched one
+		elems := strings.Split(file, "/")
+		for i := len(elems) - 1; i > 0; i-- {
+			if !all && skipEmbed(elems[i]) {
+				break
+			}
+			if ok, _ := path.Match(pattern, strings.Join(elems[:i], "/")); ok {
+				matched = append(matched, file)
+				break
+			}
+		}
+	}
+	return
+}
+
+func skipEmbed(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+// Returns all packages in nut: map from slash-separated directory (relative to nut root, "." for root package)
+// to package.
+func (nut *Nut) Packages() map[string]*build.Package {
+	packages := make(map[string]*build.Package, len(nut.Subpackages)+1)
+	for dir, pack := range nut.Subpackages {
+		packages[dir] = pack
+	}
+	packages["."] = &nut.Package
+	return packages
+}
+
+// Returns sorted directories of all packages in nut, root package (".") first.
+func (nut *Nut) PackageDirs() []string {
+	dirs := make([]string, 0, len(nut.Subpackages)+1)
+	for dir := range nut.Subpackages {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return append([]string{"."}, dirs...)
+}
+
+// Returns canonical import path of package in given directory of nut: <prefix>/<vendor>/<name>[/<dir>]
+func (nut *Nut) PackageImportPath(prefix, dir string) string {
+	if dir == "." {
+		return nut.ImportPath(prefix)
+	}
+	return nut.ImportPath(prefix) + "/" + dir
+}
+
+// Checks if import in package in directory dir refers to package in nut.
+// Packages in nut may import each other with local imports ("./sub", "../other") or with
+// import path of nut with any single-element prefix ("gonuts.io/vendor/name/sub", "localhost/vendor/name").
+// Returns directory of imported package.
+func (nut *Nut) InternalImport(dir, imp string) (target string, ok bool) {
+	if build.IsLocalImport(imp) {
+		target = path.Join(dir, imp)
+		if target == ".." || strings.HasPrefix(target, "../") {
+			return
+		}
+	} else {
+		if nut.Vendor == "" || nut.NutName() == "" {
+			return
+		}
+		p := strings.SplitN(imp, "/", 4)
+		if len(p) < 3 || p[0] == "" || p[1] != nut.Vendor || p[2] != nut.NutName() {
+			return
+		}
+		target = "."
+		if len(p) == 4 {
+			target = p[3]
+		}
+	}
+
+	if target == "." {
+		ok = true
+		return
+	}
+	_, ok = nut.Subpackages[target]
+	return
+}
+
+// Returns sorted imports of all packages in nut, except imports of packages in nut itself.
+// If tests is true, imports of tests are included.
+func (nut *Nut) imports(tests bool) (imports []string) {
+	seen := make(map[string]bool)
+	for dir, pack := range nut.Packages() {
+		lists := [][]string{pack.Imports}
+		if tests {
+			lists = append(lists, pack.TestImports, pack.XTestImports)
+		}
+		for _, list := range lists {
+			for _, imp := range list {
+				if _, ok := nut.InternalImport(dir, imp); ok || seen[imp] {
+					continue
+				}
+				seen[imp] = true
+				imports = append(imports, imp)
+			}
+		}
+	}
+	sort.Strings(imports)
+	return
+}
+
+// Returns sorted imports of all packages in nut (without tests), except imports of packages in nut itself.
+// Those are imports required to build nut.
+func (nut *Nut) ExternalImports() []string {
+	return nut.imports(false)
+}
+
+// Rewrites imports of packages in nut in Go source file with given slash-separated name (relative to nut root):
+// local imports and imports of nut with other prefix are replaced with canonical import paths with given prefix.
+// Only import paths are changed, the rest of file is left as is.
+// Other files are returned unchanged.
+func (nut *Nut) RewriteImports(name string, src []byte, prefix string) (res []byte, err error) {
+	res = src
+	dir := path.Dir(name)
+	if path.Ext(name) != ".go" || !isPackageDir(dir) {
+		return
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name, src, parser.ImportsOnly)
+	if err != nil {
+		return
+	}
+
+	// replace from the end to keep offsets valid
+	for i := len(f.Imports) - 1; i >= 0; i-- {
+		lit := f.Imports[i].Path
+		var imp string
+		imp, err = strconv.Unquote(lit.Value)
+		if err != nil {
+			return
+		}
+		target, ok := nut.InternalImport(dir, imp)
+		if !ok {
+			continue
+		}
+		newImp := nut.PackageImportPath(prefix, target)
+		if newImp == imp {
+			continue
+		}
+
+		start := fset.Position(lit.Pos()).Offset
+		end := start + len(lit.Value)
+		b := make([]byte, 0, len(res)+len(newImp))
+		b = append(b, res[:start]...)
+		b = append(b, strconv.Quote(newImp)...)
+		res = append(b, res[end:]...)
+	}
+	return
+}
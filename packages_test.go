@@ -0,0 +1,203 @@
+package nut_test
+
+import (
+	"errors"
+	"fmt"
+	"go/build"
+	"io/fs"
+	"sort"
+	"testing/fstest"
+
+	. "."
+	. "launchpad.net/gocheck"
+)
+
+type P struct {
+	nf *NutFile
+}
+
+var _ = Suite(&P{})
+
+var multiFiles = map[string]string{
+	"a.go": `// Package a is used to test nut.
+package a
+
+import (
+	"fmt"
+
+	"./sub"
+	"gonuts.io/debug/a/sub/inner"
+	"gonuts.io/debug/dep"
+)
+`,
+	"sub/sub.go":         "// Package sub is used to test nut.\npackage sub\n\nimport \"./inner\"\n",
+	"sub/inner/inner.go": "// Package inner is used to test nut.\npackage inner\n\nimport \"localhost/debug/other/x\"\n",
+	"sub/testdata/t.go":  "package broken(\n",
+	"_tools/gen.go":      "package main\n",
+	"nut.json":           `{"Version": "0.0.1", "Vendor": "debug", "Dependencies": {"gonuts.io/debug/dep": "^1"}}`,
+}
+
+func (p *P) SetUpTest(c *C) {
+	names := []string{"_tools/gen.go", "a.go", "nut.json", "sub/inner/inner.go", "sub/sub.go", "sub/testdata/t.go"}
+	p.nf = new(NutFile)
+	_, err := p.nf.ReadFrom(makeNut(c, multiFiles, names, nil))
+	c.Assert(err, IsNil)
+}
+
+func (p *P) TestPackages(c *C) {
+	c.Check(p.nf.Name, Equals, "a")
+	c.Check(p.nf.PackageDirs(), DeepEquals, []string{".", "sub", "sub/inner"})
+	c.Check(p.nf.Subpackages["sub"].Name, Equals, "sub")
+	c.Check(p.nf.Subpackages["sub"].GoFiles, DeepEquals, []string{"sub.go"})
+	c.Check(p.nf.Subpackages["sub/inner"].Name, Equals, "inner")
+	c.Check(p.nf.Packages()["."].Name, Equals, "a")
+	c.Check(p.nf.PackageImportPath("gonuts.io", "sub/inner"), Equals, "gonuts.io/debug/a/sub/inner")
+	c.Check(p.nf.ExternalImports(), DeepEquals, []string{"fmt", "gonuts.io/debug/dep", "localhost/debug/other/x"})
+}
+
+func (p *P) TestInternalImport(c *C) {
+	for _, t := range []struct {
+		dir, imp, target string
+	}{
+		{".", "./sub", "sub"},
+		{"sub", "./inner", "sub/inner"},
+		{"sub/inner", "..", "sub"},
+		{"sub/inner", "../..", "."},
+		{".", "gonuts.io/debug/a", "."},
+		{".", "localhost/debug/a/sub/inner", "sub/inner"},
+	} {
+		target, ok := p.nf.InternalImport(t.dir, t.imp)
+		c.Check(ok, Equals, true, Commentf("%s", t.imp))
+		c.Check(target, Equals, t.target, Commentf("%s", t.imp))
+	}
+
+	for _, imp := range []string{"fmt", "./missing", "../a", "gonuts.io/debug/a/missing", "gonuts.io/debug/dep", "debug/a/sub"} {
+		_, ok := p.nf.InternalImport(".", imp)
+		c.Check(ok, Equals, false, Commentf("%s", imp))
+	}
+}
+
+func (p *P) TestRewriteImports(c *C) {
+	b, err := p.nf.RewriteImports("a.go", []byte(multiFiles["a.go"]), "localhost")
+	c.Assert(err, IsNil)
+	c.Check(string(b), Equals, `// Package a is used to test nut.
+package a
+
+import (
+	"fmt"
+
+	"localhost/debug/a/sub"
+	"localhost/debug/a/sub/inner"
+	"gonuts.io/debug/dep"
+)
+`)
+
+	b, err = p.nf.RewriteImports("sub/sub.go", []byte(multiFiles["sub/sub.go"]), "gonuts.io")
+	c.Assert(err, IsNil)
+	c.Check(string(b), Equals, "// Package sub is used to test nut.\npackage sub\n\nimport \"gonuts.io/debug/a/sub/inner\"\n")
+
+	for _, name := range []string{"sub/testdata/t.go", "_tools/gen.go", "nut.json"} {
+		b, err = p.nf.RewriteImports(name, []byte(multiFiles[name]), "localhost")
+		c.Check(err, IsNil)
+		c.Check(string(b), Equals, multiFiles[name])
+	}
+}
+
+func (p *P) TestCheck(c *C) {
+	nut := p.nf.Nut
+	nut.Subpackages = map[string]*build.Package{
+		"sub":       {Name: "Sub", Doc: "Package Sub is used to test nut.", Imports: []string{"../../outside"}},
+		"sub/inner": p.nf.Subpackages["sub/inner"],
+	}
+	errors := nut.Check()
+	c.Check(errors, DeepEquals, []string{
+		`No authors given.`,
+		`Spec should include license file in ExtraFiles.`,
+		`sub: Package name should be lower case.`,
+		`Local import "../../outside" in sub doesn't refer to package in nut.`,
+	}, Commentf("%#v", errors))
+}
+
+func (*P) TestMatchEmbedPattern(c *C) {
+	files := []string{"a.txt", "b.go", "static/index.html", "static/.hidden", "static/_tmp/x", "static/css/site.css", "static/.git/config"}
+	for _, t := range []struct {
+		pattern string
+		matched []string
+	}{
+		{"a.txt", []string{"a.txt"}},
+		{"*.txt", []string{"a.txt"}},
+		{"static", []string{"static/index.html", "static/css/site.css"}},
+		{"all:static", []string{"static/index.html", "static/.hidden", "static/_tmp/x", "static/css/site.css", "static/.git/config"}},
+		{"static/*", []string{"static/index.html", "static/.hidden", "static/_tmp/x", "static/css/site.css", "static/.git/config"}},
+		{"static/.hidden", []string{"static/.hidden"}},
+		{"static/css/*.css", []string{"static/css/site.css"}},
+		{"missing", nil},
+		{"*.json", nil},
+	} {
+		c.Check(MatchEmbedPattern(t.pattern, files), DeepEquals, t.matched, Commentf("%s", t.pattern))
+	}
+}
+
+func (*P) TestCheckFiles(c *C) {
+	files := map[string]string{
+		"a.go": `// Package a is used to test nut.
+package a
+
+import _ "embed"
+
+//go:embed static
+var static string
+
+//go:embed missing/*.txt
+var missing string
+`,
+		"a_amd64.s":         "",
+		"a.h":               "",
+		"a_windows.syso":    "",
+		"a_test.go":         "package a\n",
+		"static/index.html": "",
+		"sub/sub.go":        "// Package sub is used to test nut.\npackage sub\n\n//go:embed *.txt\nvar s string\n",
+		"sub/s.txt":         "",
+		"LICENSE":           "",
+		"nut.json":          `{"Version": "0.0.1", "Vendor": "debug", "Authors": [{"FullName": "Nutter"}], "ExtraFiles": ["LICENSE", "README"]}`,
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	nf := new(NutFile)
+	_, err := nf.ReadFrom(makeNut(c, files, names, nil))
+	c.Assert(err, IsNil)
+	c.Check(SourceFiles(&nf.Package), DeepEquals, []string{"a.go", "a.h", "a_amd64.s", "a_test.go", "a_windows.syso"})
+	c.Check(EmbedPatterns(&nf.Package), DeepEquals, []string{"missing/*.txt", "static"})
+
+	errors := nf.Check()
+	c.Check(errors, DeepEquals, []string{
+		`Extra files "README" are missing from nut.`,
+		`Pattern "missing/*.txt" of //go:embed in . matches no files in nut.`,
+	}, Commentf("%#v", errors))
+}
+
+func (p *P) TestFS(c *C) {
+	c.Check(fstest.TestFS(p.nf, "a.go", "nut.json", "sub/sub.go", "sub/inner/inner.go", "sub/testdata/t.go", "_tools/gen.go"), IsNil)
+
+	entries, err := fs.ReadDir(p.nf, "sub")
+	c.Assert(err, IsNil)
+	var names []string
+	for _, e := range entries {
+		names = append(names, fmt.Sprintf("%s %v", e.Name(), e.IsDir()))
+	}
+	c.Check(names, DeepEquals, []string{"inner true", "sub.go false", "testdata true"})
+
+	fi, err := fs.Stat(p.nf, "sub/inner")
+	c.Assert(err, IsNil)
+	c.Check(fi.IsDir(), Equals, true)
+	_, err = fs.Stat(p.nf, "sub/missing")
+	c.Check(errors.Is(err, fs.ErrNotExist), Equals, true)
+
+	b, err := fs.ReadFile(p.nf, "sub/sub.go")
+	c.Assert(err, IsNil)
+	c.Check(string(b), Equals, multiFiles["sub/sub.go"])
+}
@@ -0,0 +1,329 @@
+// Package registry provides client for nut registries (gonuts.io, 'nut serve').
+package registry
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+
+	"github.com/AlekSi/nut"
+)
+
+// Default User-Agent header value.
+var DefaultUserAgent = fmt.Sprintf("nut/%s (%s/%s; %s)", nut.NutVersion, runtime.GOOS, runtime.GOARCH, runtime.Version())
+
+// Describes error response from registry.
+type ResponseError struct {
+	URL        string
+	StatusCode int
+	Message    string // from response {"Message": "..."}, may be empty
+}
+
+func (e *ResponseError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s: status code %d", e.URL, e.StatusCode)
+	}
+	return fmt.Sprintf("%s: %s", e.URL, e.Message)
+}
+
+// Error for status code 404: nut or version not found.
+type NotFoundError struct{ *ResponseError }
+
+// Error for status codes 401 and 403: token is missing or invalid.
+type UnauthorizedError struct{ *ResponseError }
+
+// Error for status code 409: published version already exists.
+type ConflictError struct{ *ResponseError }
+
+// Error for status codes 5xx.
+type ServerError struct{ *ResponseError }
+
+// Error for response which can't be parsed, e.g. nut file instead of JSON.
+type ParseError struct {
+	URL string
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Can't parse response from %s: %s", e.URL, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// Unwrap methods allow to get *ResponseError from any of them with errors.As.
+
+func (e *NotFoundError) Unwrap() error     { return e.ResponseError }
+func (e *UnauthorizedError) Unwrap() error { return e.ResponseError }
+func (e *ConflictError) Unwrap() error     { return e.ResponseError }
+func (e *ServerError) Unwrap() error       { return e.ResponseError }
+
+// Returns typed error for response with non-2xx status code.
+func responseError(u *url.URL, res *http.Response) error {
+	e := &ResponseError{URL: u.String(), StatusCode: res.StatusCode}
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	var body struct{ Message string }
+	if json.Unmarshal(b, &body) == nil {
+		e.Message = body.Message
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return &NotFoundError{e}
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return &UnauthorizedError{e}
+	case res.StatusCode == http.StatusConflict:
+		return &ConflictError{e}
+	case res.StatusCode/100 == 5:
+		return &ServerError{e}
+	}
+	return e
+}
+
+// Client for nut registry API (see nut.Server).
+type Client struct {
+	BaseURL    *url.URL     // nuts are at <BaseURL>/<vendor>/<name>
+	HTTPClient *http.Client // http.DefaultClient if nil, see NewHTTPClient
+	UserAgent  string       // DefaultUserAgent if empty
+	Token      string       // access token for Publish
+	Insecure   bool         // allow plain HTTP; only HTTPS URLs are used by default
+
+	// If not nil, called to log requests.
+	Logf func(format string, v ...interface{})
+}
+
+// Returns client for registry with given base URL.
+func NewClient(baseURL string) (c *Client, err error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err == nil && ((u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		err = fmt.Errorf("Registry URL should be absolute http(s) URL, got %q.", baseURL)
+	}
+	if err != nil {
+		return
+	}
+	c = &Client{BaseURL: u}
+	return
+}
+
+// Returns URL of nut with given vendor, name and version (nil for the latest).
+func (c *Client) URL(vendor, name string, version *nut.Version) *url.URL {
+	u := *c.BaseURL
+	u.Path += "/" + vendor + "/" + name
+	if version != nil {
+		u.Path += "/" + version.String()
+	}
+	return &u
+}
+
+// Returns HTTP client with TLS settings for registry. CAFile is PEM file with CA certificates
+// trusted in addition to system ones, certFile and keyFile are PEM files with client certificate
+// and its private key for mutual TLS. Empty file names are ignored.
+func NewHTTPClient(caFile, certFile, keyFile string) (client *http.Client, err error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		var b []byte
+		b, err = ioutil.ReadFile(caFile)
+		if err != nil {
+			return
+		}
+		config.RootCAs, _ = x509.SystemCertPool()
+		if config.RootCAs == nil {
+			config.RootCAs = x509.NewCertPool()
+		}
+		if !config.RootCAs.AppendCertsFromPEM(b) {
+			err = fmt.Errorf("No certificates found in %s.", caFile)
+			return
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			err = fmt.Errorf("Both client certificate and key files should be given.")
+			return
+		}
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			err = fmt.Errorf("Can't load client certificate: %s", err)
+			return
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	client = &http.Client{Transport: transport}
+	return
+}
+
+func insecureError(u *url.URL) error {
+	return fmt.Errorf("Refusing to use insecure URL %s: plain HTTP is allowed only for insecure registries.", u)
+}
+
+func (c *Client) do(req *http.Request, accept string) (res *http.Response, err error) {
+	if req.URL.Scheme != "https" && !c.Insecure {
+		err = insecureError(req.URL)
+		return
+	}
+	if c.Logf != nil {
+		c.Logf("%s %s ...", req.Method, req.URL)
+	}
+	userAgent := c.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", accept)
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if !c.Insecure {
+		// refuse redirects to plain HTTP before request (with token) is sent
+		secure := *client
+		checkRedirect := client.CheckRedirect
+		secure.CheckRedirect = func(r *http.Request, via []*http.Request) error {
+			if r.URL.Scheme != "https" {
+				return insecureError(r.URL)
+			}
+			if checkRedirect != nil {
+				return checkRedirect(r, via)
+			}
+			if len(via) >= 10 {
+				return fmt.Errorf("Stopped after 10 redirects.")
+			}
+			return nil
+		}
+		client = &secure
+	}
+	res, err = client.Do(req)
+	if err != nil {
+		return
+	}
+	if c.Logf != nil {
+		c.Logf("Status code %d", res.StatusCode)
+	}
+
+	if res.StatusCode/100 != 2 {
+		defer res.Body.Close()
+		err = responseError(req.URL, res)
+		res = nil
+	}
+	return
+}
+
+// Sends GET request to URL and returns response body.
+// Responses with non-2xx status code are returned as errors (see ResponseError).
+func (c *Client) Open(u *url.URL, accept string) (body io.ReadCloser, err error) {
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return
+	}
+	res, err := c.do(req, accept)
+	if err != nil {
+		return
+	}
+	body = res.Body
+	return
+}
+
+// Sends GET request to URL and decodes JSON response into v.
+func (c *Client) getJSON(u *url.URL, v interface{}) (err error) {
+	body, err := c.Open(u, "application/json")
+	if err != nil {
+		return
+	}
+	defer body.Close()
+
+	err = json.NewDecoder(body).Decode(v)
+	if err != nil {
+		err = &ParseError{URL: u.String(), Err: err}
+	}
+	return
+}
+
+// Returns nut file with given vendor, name and version (nil for the latest).
+func (c *Client) Get(vendor, name string, version *nut.Version) (io.ReadCloser, error) {
+	return c.Open(c.URL(vendor, name, version), "application/zip")
+}
+
+// Returns available versions of nut.
+func (c *Client) Versions(vendor, name string) ([]*nut.Version, error) {
+	return c.VersionsAt(c.URL(vendor, name, nil))
+}
+
+// Returns available versions of nut at URL (without version).
+// Registry should list versions in JSON: {"Versions": ["0.0.1", ...]}.
+func (c *Client) VersionsAt(u *url.URL) (versions []*nut.Version, err error) {
+	var body struct {
+		Versions []*nut.Version
+	}
+	err = c.getJSON(u, &body)
+	versions = body.Versions
+	return
+}
+
+// Returns information about nut with given vendor, name and version (nil for the latest).
+// For the latest version Versions are set too.
+func (c *Client) Info(vendor, name string, version *nut.Version) (info *nut.NutInfo, err error) {
+	info = new(nut.NutInfo)
+	err = c.getJSON(c.URL(vendor, name, version), info)
+	if err != nil {
+		info = nil
+	}
+	return
+}
+
+// Returns information about the latest versions of nuts with query in vendor, name or summary.
+func (c *Client) Search(query string) (nuts []*nut.NutInfo, err error) {
+	u := *c.BaseURL
+	u.Path += "/-/search"
+	u.RawQuery = url.Values{"q": {query}}.Encode()
+
+	var body struct {
+		Nuts []*nut.NutInfo
+	}
+	err = c.getJSON(&u, &body)
+	nuts = body.Nuts
+	return
+}
+
+// Publishes nut file with given vendor, name and version and returns registry message.
+// Token is sent in "Authorization: Bearer <token>" header.
+func (c *Client) Publish(vendor, name string, version *nut.Version, b []byte) (message string, err error) {
+	u := c.URL(vendor, name, version)
+	req, err := http.NewRequest("PUT", u.String(), bytes.NewReader(b))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/zip")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	res, err := c.do(req, "application/json")
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	var body struct{ Message string }
+	err = json.NewDecoder(res.Body).Decode(&body)
+	if err != nil {
+		err = &ParseError{URL: u.String(), Err: err}
+	}
+	message = body.Message
+	return
+}
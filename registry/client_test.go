@@ -0,0 +1,241 @@
+package registry_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "."
+	"github.com/AlekSi/nut"
+	. "launchpad.net/gocheck"
+)
+
+type Cl struct {
+	server    *httptest.Server
+	client    *Client
+	userAgent string
+}
+
+var _ = Suite(&Cl{})
+
+func (cl *Cl) SetUpTest(c *C) {
+	s := &nut.Server{Dir: c.MkDir(), Token: "secret"}
+	cl.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cl.userAgent = r.Header.Get("User-Agent")
+		c.Check(r.URL.RawQuery, Not(Matches), ".*token.*")
+		if r.URL.Path == "/nuts/-/fail" {
+			http.Error(w, "failed", http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Path == "/nuts/-/zip" {
+			w.Write(pack(c, "a", "0.0.1"))
+			return
+		}
+		http.StripPrefix("/nuts", s).ServeHTTP(w, r)
+	}))
+
+	var err error
+	cl.client, err = NewClient(cl.server.URL + "/nuts/")
+	c.Assert(err, IsNil)
+	cl.client.Token = "secret"
+	cl.client.Insecure = true
+}
+
+func (cl *Cl) TearDownTest(c *C) {
+	cl.server.Close()
+}
+
+// Packs nut with given name and version.
+func pack(c *C, name, version string) []byte {
+	buf := new(bytes.Buffer)
+	nw := nut.NewNutWriter(buf)
+	c.Assert(nw.Add(name+".go", []byte(fmt.Sprintf("// Package %s is used to test nut.\npackage %s\n", name, name))), IsNil)
+	c.Assert(nw.Add("LICENSE", []byte("license")), IsNil)
+	spec := fmt.Sprintf(`{"Version": %q, "Vendor": "debug", "Authors": [{"FullName": "Alexey Palazhchenko"}], "ExtraFiles": ["LICENSE"]}`, version)
+	c.Assert(nw.Add(nut.SpecFileName, []byte(spec)), IsNil)
+	c.Assert(nw.Close(), IsNil)
+	return buf.Bytes()
+}
+
+func (*Cl) TestNewClient(c *C) {
+	client, err := NewClient("https://example.com/nuts/")
+	c.Assert(err, IsNil)
+	c.Check(client.URL("debug", "a", nil).String(), Equals, "https://example.com/nuts/debug/a")
+	c.Check(client.URL("debug", "a", &nut.Version{Minor: 1}).String(), Equals, "https://example.com/nuts/debug/a/0.1.0")
+
+	_, err = NewClient("example.com")
+	c.Check(err, ErrorMatches, `Registry URL should be absolute http\(s\) URL, got "example.com".`)
+}
+
+func (cl *Cl) TestClient(c *C) {
+	v1, v2 := &nut.Version{Patch: 1}, &nut.Version{Minor: 1}
+	b1, b2 := pack(c, "a", "0.0.1"), pack(c, "a", "0.1.0")
+
+	m, err := cl.client.Publish("debug", "a", v1, b1)
+	c.Check(err, IsNil)
+	c.Check(m, Equals, "Nut debug/a version 0.0.1 published.")
+	c.Check(strings.HasPrefix(cl.userAgent, "nut/"+nut.NutVersion+" "), Equals, true)
+	_, err = cl.client.Publish("debug", "a", v2, b2)
+	c.Check(err, IsNil)
+
+	versions, err := cl.client.Versions("debug", "a")
+	c.Check(err, IsNil)
+	c.Check(versions, DeepEquals, []*nut.Version{v1, v2})
+
+	rc, err := cl.client.Get("debug", "a", v1)
+	c.Assert(err, IsNil)
+	b, err := ioutil.ReadAll(rc)
+	c.Check(err, IsNil)
+	c.Check(rc.Close(), IsNil)
+	c.Check(bytes.Equal(b, b1), Equals, true)
+
+	info, err := cl.client.Info("debug", "a", nil)
+	c.Assert(err, IsNil)
+	c.Check(info.Version, DeepEquals, v2)
+	c.Check(info.Doc, Equals, "Package a is used to test nut.")
+	c.Check(info.Versions, DeepEquals, []*nut.Version{v1, v2})
+
+	nuts, err := cl.client.Search("test")
+	c.Assert(err, IsNil)
+	c.Assert(nuts, HasLen, 1)
+	c.Check(nuts[0].Name, Equals, "a")
+
+	cl.client.UserAgent = "test"
+	nuts, err = cl.client.Search("none")
+	c.Check(err, IsNil)
+	c.Check(nuts, HasLen, 0)
+	c.Check(cl.userAgent, Equals, "test")
+}
+
+func (cl *Cl) TestErrors(c *C) {
+	b := pack(c, "a", "0.0.1")
+
+	_, err := cl.client.Versions("debug", "a")
+	c.Check(err, FitsTypeOf, &NotFoundError{})
+	c.Check(err, ErrorMatches, `http://.+/nuts/debug/a: Nut debug/a not found.`)
+	_, err = cl.client.Get("debug", "a", &nut.Version{Patch: 1})
+	c.Check(err, FitsTypeOf, &NotFoundError{})
+
+	cl.client.Token = "wrong"
+	_, err = cl.client.Publish("debug", "a", &nut.Version{Patch: 1}, b)
+	c.Check(err, FitsTypeOf, &UnauthorizedError{})
+	c.Check(err, ErrorMatches, `http://.+/nuts/debug/a/0.0.1: Invalid token.`)
+
+	cl.client.Token = "secret"
+	_, err = cl.client.Publish("debug", "a", &nut.Version{Patch: 1}, b)
+	c.Check(err, IsNil)
+	_, err = cl.client.Publish("debug", "a", &nut.Version{Patch: 1}, b)
+	c.Check(err, FitsTypeOf, &ConflictError{})
+	c.Check(err.(*ConflictError).StatusCode, Equals, http.StatusConflict)
+	c.Check(err.(*ConflictError).Message, Equals, "Nut debug/a version 0.0.1 already exists.")
+	var re *ResponseError
+	c.Check(errors.As(err, &re), Equals, true)
+	c.Check(re.Message, Equals, "Nut debug/a version 0.0.1 already exists.")
+
+	_, err = cl.client.Versions("-", "fail")
+	c.Check(err, FitsTypeOf, &ServerError{})
+	c.Check(err, ErrorMatches, `http://.+/nuts/-/fail: status code 500`)
+
+	_, err = cl.client.Versions("-", "zip")
+	c.Check(err, FitsTypeOf, &ParseError{})
+	c.Check(err, ErrorMatches, `Can't parse response from http://.+/nuts/-/zip: .+`)
+
+	cl.client.Insecure = false
+	_, err = cl.client.Versions("debug", "a")
+	c.Check(err, ErrorMatches, `Refusing to use insecure URL http://.+/nuts/debug/a: plain HTTP is allowed only for insecure registries.`)
+}
+
+func (*Cl) TestRedirectToHTTP(c *C) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Errorf("Plain HTTP server got request %s %s with Authorization %q.", r.Method, r.URL, r.Header.Get("Authorization"))
+	}))
+	defer plain.Close()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, plain.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	c.Assert(err, IsNil)
+	client.HTTPClient = server.Client()
+	client.Token = "secret"
+	_, err = client.Publish("debug", "a", &nut.Version{Patch: 1}, pack(c, "a", "0.0.1"))
+	c.Check(err, ErrorMatches, `.*Refusing to use insecure URL http://.+/debug/a/0.0.1: plain HTTP is allowed only for insecure registries.`)
+	_, err = client.Versions("debug", "a")
+	c.Check(err, ErrorMatches, `.*Refusing to use insecure URL http://.+/debug/a: plain HTTP is allowed only for insecure registries.`)
+}
+
+// Writes PEM block to file in dir and returns file name.
+func writePEM(c *C, dir, name, typ string, b []byte) string {
+	fileName := filepath.Join(dir, name)
+	c.Assert(ioutil.WriteFile(fileName, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b}), 0600), IsNil)
+	return fileName
+}
+
+func (*Cl) TestTLS(c *C) {
+	dir := c.MkDir()
+
+	// self-signed client certificate
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "nut"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+	clientCert, err := x509.ParseCertificate(der)
+	c.Assert(err, IsNil)
+	certFile := writePEM(c, dir, "client.pem", "CERTIFICATE", der)
+	b, err := x509.MarshalPKCS8PrivateKey(key)
+	c.Assert(err, IsNil)
+	keyFile := writePEM(c, dir, "client-key.pem", "PRIVATE KEY", b)
+
+	// registry with its own CA requiring client certificate
+	server := httptest.NewUnstartedServer(&nut.Server{Dir: c.MkDir()})
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: x509.NewCertPool()}
+	server.TLS.ClientCAs.AddCert(clientCert)
+	server.StartTLS()
+	defer server.Close()
+	caFile := writePEM(c, dir, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	client, err := NewClient(server.URL)
+	c.Assert(err, IsNil)
+
+	// unknown CA
+	_, err = client.Versions("debug", "a")
+	c.Check(err, ErrorMatches, `.*certificate.*`)
+
+	// no client certificate
+	client.HTTPClient, err = NewHTTPClient(caFile, "", "")
+	c.Assert(err, IsNil)
+	_, err = client.Versions("debug", "a")
+	c.Check(err, ErrorMatches, `.*certificate.*`)
+
+	client.HTTPClient, err = NewHTTPClient(caFile, certFile, keyFile)
+	c.Assert(err, IsNil)
+	_, err = client.Versions("debug", "a")
+	c.Check(err, FitsTypeOf, &NotFoundError{})
+
+	_, err = NewHTTPClient(caFile, certFile, "")
+	c.Check(err, ErrorMatches, `Both client certificate and key files should be given.`)
+	_, err = NewHTTPClient(keyFile, "", "")
+	c.Check(err, ErrorMatches, `No certificates found in .+/client-key.pem.`)
+}
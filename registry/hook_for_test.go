@@ -0,0 +1,10 @@
+package registry_test
+
+import (
+	"testing"
+
+	. "launchpad.net/gocheck"
+)
+
+// Global gocheck hook.
+func TestRegistry(t *testing.T) { TestingT(t) }
@@ -0,0 +1,246 @@
+package nut
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Resolver selects versions of nuts and their dependencies satisfying all version constraints.
+// Nuts are identified by import paths (or other strings understood by Versions and Get).
+// Resolver uses backtracking: it tries the highest suitable version of each nut first,
+// and falls back to lower versions if they lead to conflicts.
+type Resolver struct {
+	// Returns all available versions of nut.
+	Versions func(importPath string) ([]*Version, error)
+
+	// Returns nut with given version.
+	Get func(importPath string, version *Version) (*NutFile, error)
+
+	// Returns import paths of nuts among given imports (without duplicates);
+	// imports of packages in nut subdirectories are replaced with import path of nut.
+	NutImports func(imports []string) []string
+}
+
+// Describes single version requirement for nut.
+type Requirement struct {
+	Constraint *Constraint
+
+	// Chain of nuts which caused requirement, starting with the nut which directly
+	// depends on required one, in format "<import path> <version>". Empty for requested nuts.
+	RequiredBy []string
+}
+
+func (req Requirement) String() string {
+	if len(req.RequiredBy) == 0 {
+		return fmt.Sprintf("%s requested", req.Constraint)
+	}
+	return fmt.Sprintf("%s required by %s", req.Constraint, strings.Join(req.RequiredBy, " <- "))
+}
+
+// Describes conflict: no available version of nut satisfies all requirements.
+type ConflictError struct {
+	ImportPath   string
+	Available    []*Version
+	Requirements []Requirement
+}
+
+func (e *ConflictError) Error() string {
+	res := fmt.Sprintf("Can't select version of %s, no version satisfies all constraints:", e.ImportPath)
+	for _, req := range e.Requirements {
+		res += "\n    " + req.String()
+	}
+
+	available := make([]string, len(e.Available))
+	for i, v := range e.Available {
+		available[i] = v.String()
+	}
+	if len(available) == 0 {
+		available = []string{"none"}
+	}
+	res += fmt.Sprintf("\nAvailable versions: %s.", strings.Join(available, ", "))
+	return res
+}
+
+// Resolves versions for given nuts and all their dependencies.
+// Roots maps import paths to constraints, nil constraint means any version except pre-releases.
+// Returns map from import path to selected nut.
+// Returns *ConflictError if versions can't be selected.
+func (r *Resolver) Resolve(roots map[string]*Constraint) (nuts map[string]*NutFile, err error) {
+	s := &resolveState{
+		r:        r,
+		versions: make(map[string][]*Version),
+		nuts:     make(map[string]*NutFile),
+		reqs:     make(map[string][]Requirement),
+		selected: make(map[string]*NutFile),
+	}
+
+	s.anyVersion, err = NewConstraint("*")
+	if err != nil {
+		panic(err)
+	}
+
+	for path, c := range roots {
+		if c == nil {
+			c = s.anyVersion
+		}
+		s.reqs[path] = append(s.reqs[path], Requirement{Constraint: c})
+	}
+
+	err = s.resolve()
+	if err != nil {
+		return
+	}
+
+	nuts = s.selected
+	return
+}
+
+type resolveState struct {
+	r          *Resolver
+	anyVersion *Constraint
+	versions   map[string][]*Version    // import path => available versions (cached)
+	nuts       map[string]*NutFile      // "<import path> <version>" => nut (cached)
+	reqs       map[string][]Requirement // import path => requirements
+	selected   map[string]*NutFile      // import path => selected nut
+}
+
+func (s *resolveState) conflict(path string) *ConflictError {
+	reqs := make([]Requirement, len(s.reqs[path]))
+	copy(reqs, s.reqs[path])
+	return &ConflictError{ImportPath: path, Available: s.versions[path], Requirements: reqs}
+}
+
+// Returns next import path to select version for (in lexical order for reproducibility),
+// or empty string if all required nuts are selected.
+func (s *resolveState) next() string {
+	var paths []string
+	for path := range s.reqs {
+		if _, ok := s.selected[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return ""
+	}
+	sort.Strings(paths)
+	return paths[0]
+}
+
+// Returns available versions of nut sorted from the highest to the lowest.
+func (s *resolveState) available(path string) (versions []*Version, err error) {
+	versions, ok := s.versions[path]
+	if ok {
+		return
+	}
+
+	versions, err = s.r.Versions(path)
+	if err != nil {
+		return
+	}
+	sort.Sort(sort.Reverse(byVersion(versions)))
+	s.versions[path] = versions
+	return
+}
+
+func (s *resolveState) get(path string, version *Version) (nf *NutFile, err error) {
+	key := path + " " + version.String()
+	nf, ok := s.nuts[key]
+	if ok {
+		return
+	}
+
+	nf, err = s.r.Get(path, version)
+	if err != nil {
+		return
+	}
+	s.nuts[key] = nf
+	return
+}
+
+func (s *resolveState) resolve() error {
+	path := s.next()
+	if path == "" {
+		return nil
+	}
+
+	versions, err := s.available(path)
+	if err != nil {
+		return err
+	}
+
+	var candidates []*Version
+	for _, v := range versions {
+		ok := true
+		for _, req := range s.reqs[path] {
+			if !req.Constraint.Check(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			candidates = append(candidates, v)
+		}
+	}
+
+	var conflict error = s.conflict(path)
+	for _, v := range candidates {
+		nf, err := s.get(path, v)
+		if err != nil {
+			return err
+		}
+
+		chain := append([]string{fmt.Sprintf("%s %s", path, v)}, s.reqs[path][0].RequiredBy...)
+		s.selected[path] = nf
+
+		// add requirements of selected version, check already selected nuts
+		var added []string
+		ok := true
+		for _, dep := range s.r.NutImports(nf.ExternalImports()) {
+			c, err := nf.DependencyConstraint(dep)
+			if err != nil {
+				return fmt.Errorf("%s %s: %s", path, v, err)
+			}
+			if c == nil {
+				c = s.anyVersion
+			}
+			s.reqs[dep] = append(s.reqs[dep], Requirement{Constraint: c, RequiredBy: chain})
+			added = append(added, dep)
+
+			if sel, present := s.selected[dep]; present && !c.Check(&sel.Version) {
+				conflict = s.conflict(dep)
+				ok = false
+				break
+			}
+		}
+
+		if ok {
+			err = s.resolve()
+			if err == nil {
+				return nil
+			}
+			if _, isConflict := err.(*ConflictError); !isConflict {
+				return err
+			}
+			conflict = err
+		}
+
+		// backtrack
+		for _, dep := range added {
+			s.reqs[dep] = s.reqs[dep][:len(s.reqs[dep])-1]
+			if len(s.reqs[dep]) == 0 {
+				delete(s.reqs, dep)
+			}
+		}
+		delete(s.selected, path)
+	}
+
+	return conflict
+}
+
+// byVersion implements sort.Interface.
+type byVersion []*Version
+
+func (v byVersion) Len() int           { return len(v) }
+func (v byVersion) Less(i, j int) bool { return v[i].Less(v[j]) }
+func (v byVersion) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
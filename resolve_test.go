@@ -0,0 +1,159 @@
+package nut_test
+
+import (
+	"fmt"
+	"go/build"
+	"sort"
+	"strings"
+
+	. "."
+	. "launchpad.net/gocheck"
+)
+
+type R struct {
+	nuts map[string]map[string]*NutFile // import path => version => nut
+	gets []string
+}
+
+var _ = Suite(&R{})
+
+func (r *R) SetUpTest(c *C) {
+	r.nuts = make(map[string]map[string]*NutFile)
+	r.gets = nil
+}
+
+// Adds nut with given import path, version and dependencies (import path => constraint, "" for none).
+func (r *R) add(c *C, path, version string, deps map[string]string) {
+	v, err := NewVersion(version)
+	c.Assert(err, IsNil)
+
+	nf := new(NutFile)
+	nf.Version = *v
+	nf.Dependencies = make(map[string]string)
+	for dep, cons := range deps {
+		nf.Imports = append(nf.Imports, dep)
+		if cons != "" {
+			nf.Dependencies[dep] = cons
+		}
+	}
+	nf.Imports = append(nf.Imports, "fmt")
+	sort.Strings(nf.Imports)
+	nf.Package = build.Package{Name: path[strings.LastIndex(path, "/")+1:], Imports: nf.Imports}
+
+	if r.nuts[path] == nil {
+		r.nuts[path] = make(map[string]*NutFile)
+	}
+	r.nuts[path][version] = nf
+}
+
+func (r *R) resolver() *Resolver {
+	return &Resolver{
+		Versions: func(path string) (versions []*Version, err error) {
+			if r.nuts[path] == nil {
+				err = fmt.Errorf("%s not found", path)
+				return
+			}
+			for _, nf := range r.nuts[path] {
+				v := nf.Version
+				versions = append(versions, &v)
+			}
+			return
+		},
+		Get: func(path string, version *Version) (*NutFile, error) {
+			r.gets = append(r.gets, path+" "+version.String())
+			return r.nuts[path][version.String()], nil
+		},
+		NutImports: func(imports []string) (nuts []string) {
+			for _, imp := range imports {
+				if strings.HasPrefix(imp, "gonuts.io/") {
+					nuts = append(nuts, imp)
+				}
+			}
+			return
+		},
+	}
+}
+
+func versions(nuts map[string]*NutFile) map[string]string {
+	res := make(map[string]string, len(nuts))
+	for path, nf := range nuts {
+		res[path] = nf.Version.String()
+	}
+	return res
+}
+
+func (r *R) TestResolveHighest(c *C) {
+	r.add(c, "gonuts.io/debug/a", "0.1.0", map[string]string{"gonuts.io/debug/c": "^1.0"})
+	r.add(c, "gonuts.io/debug/a", "0.2.0", map[string]string{"gonuts.io/debug/b": "", "gonuts.io/debug/c": "^1.1"})
+	r.add(c, "gonuts.io/debug/a", "0.3.0-rc.1", nil)
+	r.add(c, "gonuts.io/debug/b", "1.0.0", map[string]string{"gonuts.io/debug/c": ">=1.0.0 <1.2.0"})
+	r.add(c, "gonuts.io/debug/c", "1.0.0", nil)
+	r.add(c, "gonuts.io/debug/c", "1.1.5", nil)
+	r.add(c, "gonuts.io/debug/c", "1.2.0", nil)
+
+	nuts, err := r.resolver().Resolve(map[string]*Constraint{"gonuts.io/debug/a": nil})
+	c.Assert(err, IsNil)
+	c.Check(versions(nuts), DeepEquals, map[string]string{
+		"gonuts.io/debug/a": "0.2.0",
+		"gonuts.io/debug/b": "1.0.0",
+		"gonuts.io/debug/c": "1.1.5",
+	})
+
+	// pre-release requested explicitly
+	cons, err := NewConstraint("0.3.0-rc.1")
+	c.Assert(err, IsNil)
+	nuts, err = r.resolver().Resolve(map[string]*Constraint{"gonuts.io/debug/a": cons})
+	c.Assert(err, IsNil)
+	c.Check(versions(nuts), DeepEquals, map[string]string{"gonuts.io/debug/a": "0.3.0-rc.1"})
+}
+
+func (r *R) TestResolveBacktrack(c *C) {
+	// the highest version of b requires c 2.x, incompatible with a
+	r.add(c, "gonuts.io/debug/a", "1.0.0", map[string]string{"gonuts.io/debug/b": "", "gonuts.io/debug/c": "^1"})
+	r.add(c, "gonuts.io/debug/b", "1.0.0", map[string]string{"gonuts.io/debug/c": "^1"})
+	r.add(c, "gonuts.io/debug/b", "1.1.0", map[string]string{"gonuts.io/debug/c": "^2"})
+	r.add(c, "gonuts.io/debug/c", "1.0.0", nil)
+	r.add(c, "gonuts.io/debug/c", "2.0.0", nil)
+
+	nuts, err := r.resolver().Resolve(map[string]*Constraint{"gonuts.io/debug/a": nil})
+	c.Assert(err, IsNil)
+	c.Check(versions(nuts), DeepEquals, map[string]string{
+		"gonuts.io/debug/a": "1.0.0",
+		"gonuts.io/debug/b": "1.0.0",
+		"gonuts.io/debug/c": "1.0.0",
+	})
+}
+
+func (r *R) TestResolveConflict(c *C) {
+	r.add(c, "gonuts.io/debug/root", "0.1.0", map[string]string{"gonuts.io/debug/a": "", "gonuts.io/debug/b": ""})
+	r.add(c, "gonuts.io/debug/a", "1.0.0", map[string]string{"gonuts.io/debug/c": "^1"})
+	r.add(c, "gonuts.io/debug/b", "1.0.0", map[string]string{"gonuts.io/debug/c": "^2"})
+	r.add(c, "gonuts.io/debug/c", "1.0.0", nil)
+	r.add(c, "gonuts.io/debug/c", "2.0.0", nil)
+
+	_, err := r.resolver().Resolve(map[string]*Constraint{"gonuts.io/debug/root": nil})
+	c.Assert(err, FitsTypeOf, &ConflictError{})
+	c.Check(err.Error(), Equals, `
+Can't select version of gonuts.io/debug/c, no version satisfies all constraints:
+    ^1 required by gonuts.io/debug/a 1.0.0 <- gonuts.io/debug/root 0.1.0
+    ^2 required by gonuts.io/debug/b 1.0.0 <- gonuts.io/debug/root 0.1.0
+Available versions: 2.0.0, 1.0.0.`[1:])
+}
+
+func (r *R) TestResolveErrors(c *C) {
+	r.add(c, "gonuts.io/debug/a", "1.0.0", map[string]string{"gonuts.io/debug/missing": ""})
+
+	_, err := r.resolver().Resolve(map[string]*Constraint{"gonuts.io/debug/a": nil})
+	c.Check(err, ErrorMatches, "gonuts.io/debug/missing not found")
+
+	cons, err := NewConstraint("^2")
+	c.Assert(err, IsNil)
+	_, err = r.resolver().Resolve(map[string]*Constraint{"gonuts.io/debug/a": cons})
+	c.Check(err, ErrorMatches, `(?s)Can't select version of gonuts.io/debug/a.*\^2 requested.*Available versions: 1.0.0.`)
+	c.Check(r.gets, DeepEquals, []string{"gonuts.io/debug/a 1.0.0"})
+
+	// invalid constraint is not treated as any version
+	r.add(c, "gonuts.io/debug/b", "1.0.0", map[string]string{"gonuts.io/debug/a": "^1.x.y"})
+	_, err = r.resolver().Resolve(map[string]*Constraint{"gonuts.io/debug/b": nil})
+	c.Check(err, ErrorMatches, `gonuts.io/debug/b 1.0.0: Dependency "gonuts.io/debug/a": Bad constraint "\^1.x.y": .+`)
+}
@@ -0,0 +1,379 @@
+package nut
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Describes nut version in registry.
+type NutInfo struct {
+	Vendor   string
+	Name     string
+	Version  *Version
+	Doc      string     `json:",omitempty"` // package summary
+	Homepage string     `json:",omitempty"`
+	Authors  []Person   `json:",omitempty"`
+	Versions []*Version `json:",omitempty"` // all available versions, sorted; set only for the latest version
+}
+
+// Returns information about nut.
+func (nut *Nut) Info() *NutInfo {
+	return &NutInfo{
+		Vendor:   nut.Vendor,
+		Name:     nut.NutName(),
+		Version:  &nut.Version,
+		Doc:      nut.Package.Doc,
+		Homepage: nut.Homepage,
+		Authors:  nut.Authors,
+	}
+}
+
+// Serves nuts stored in directory as <Dir>/<vendor>/<name>-<version>.nut.
+//
+// GET /<vendor>/<name> returns the latest nut (the latest pre-release only if there are no releases);
+// with "Accept: application/json" it returns NutInfo of that version with all available versions
+// as {"Versions": ["0.0.1", ...], ...}.
+// GET /<vendor>/<name>/<version> and /<vendor>/<name>-<version>.nut return nut of that version
+// (NutInfo with "Accept: application/json").
+// GET /-/search?q=<query> returns NutInfo of the latest versions of nuts with query
+// in vendor, name or summary as {"Nuts": [...]}.
+//
+// PUT /<vendor>/<name>/<version> with token (in "Authorization: Bearer <token>" header) publishes nut.
+// Token in query parameter is not accepted: it may leak into access logs.
+// Published nut should match URL and pass check (see NutFile.ConsumerFindings) unless NoCheck is set.
+// Published versions can't be replaced.
+//
+// Errors and PUT results are returned as {"Message": "..."}.
+type Server struct {
+	Dir     string // directory with nuts
+	Token   string // token for publishing; if empty, publishing is disabled
+	NoCheck bool   // do not check published nuts for errors (not recommended)
+	Rules   Rules  // overrides severities of check rules; nut's own Spec.Rules may only raise them
+
+	// If not nil, called to log requests.
+	Logf func(format string, v ...interface{})
+
+	m sync.Mutex // serializes publishing
+}
+
+// check interface
+var (
+	_ http.Handler = &Server{}
+)
+
+// Handles request. Implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Logf != nil {
+		s.Logf("%s %s", r.Method, r.URL.Path)
+	}
+
+	if r.URL.Path == "/-/search" && (r.Method == "GET" || r.Method == "HEAD") {
+		s.search(w, r.URL.Query().Get("q"))
+		return
+	}
+
+	vendor, name, version, ok := parseServerPath(r.URL.Path)
+	if !ok {
+		s.message(w, http.StatusNotFound, "Not found.")
+		return
+	}
+
+	switch r.Method {
+	case "GET", "HEAD":
+		s.get(w, r, vendor, name, version)
+	case "PUT":
+		if version == "" || strings.HasSuffix(r.URL.Path, ".nut") {
+			s.message(w, http.StatusNotFound, "Not found.")
+			return
+		}
+		s.put(w, r, vendor, name, version)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		s.message(w, http.StatusMethodNotAllowed, "Method not allowed.")
+	}
+}
+
+// Returns vendor, name and version (empty if not given) from /<vendor>/<name>[/<version>] or
+// /<vendor>/<name>-<version>.nut.
+func parseServerPath(p string) (vendor, name, version string, ok bool) {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	switch {
+	case len(parts) == 2 && strings.HasSuffix(parts[1], ".nut"):
+		nv := strings.SplitN(strings.TrimSuffix(parts[1], ".nut"), "-", 2)
+		if len(nv) != 2 {
+			return
+		}
+		vendor, name, version = parts[0], nv[0], nv[1]
+	case len(parts) == 2:
+		vendor, name = parts[0], parts[1]
+	case len(parts) == 3:
+		vendor, name, version = parts[0], parts[1], parts[2]
+	default:
+		return
+	}
+
+	if !VendorRegexp.MatchString(vendor) || !VendorRegexp.MatchString(name) {
+		return
+	}
+	if version != "" {
+		v, err := NewVersion(version)
+		if err != nil {
+			return
+		}
+		version = v.String()
+	}
+	ok = true
+	return
+}
+
+// Writes message as JSON with given status code.
+func (s *Server) message(w http.ResponseWriter, code int, format string, v ...interface{}) {
+	s.json(w, code, map[string]string{"Message": fmt.Sprintf(format, v...)})
+}
+
+// Writes value as JSON with given status code.
+func (s *Server) json(w http.ResponseWriter, code int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(append(b, '\n'))
+}
+
+// Returns path of nut file.
+func (s *Server) path(vendor, name, version string) string {
+	return filepath.Join(s.Dir, vendor, name+"-"+version+".nut")
+}
+
+// Returns sorted versions of nut.
+func (s *Server) versions(vendor, name string) (versions []*Version, err error) {
+	fis, err := ioutil.ReadDir(filepath.Join(s.Dir, vendor))
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+
+	for _, fi := range fis {
+		n := fi.Name()
+		if !fi.Mode().IsRegular() || !strings.HasPrefix(n, name+"-") || !strings.HasSuffix(n, ".nut") {
+			continue
+		}
+		v, e := NewVersion(strings.TrimSuffix(n[len(name)+1:], ".nut"))
+		if e == nil {
+			versions = append(versions, v)
+		}
+	}
+	sort.Sort(byVersion(versions))
+	return
+}
+
+// Returns the latest version: the latest release, or the latest pre-release if there are no releases.
+func latestVersion(versions []*Version) *Version {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if !versions[i].IsPreRelease() {
+			return versions[i]
+		}
+	}
+	return versions[len(versions)-1]
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request, vendor, name, version string) {
+	var versions []*Version
+	if version == "" {
+		var err error
+		versions, err = s.versions(vendor, name)
+		if err != nil {
+			s.message(w, http.StatusInternalServerError, "%s", err)
+			return
+		}
+		if len(versions) == 0 {
+			s.message(w, http.StatusNotFound, "Nut %s/%s not found.", vendor, name)
+			return
+		}
+		version = latestVersion(versions).String()
+	}
+
+	f, err := os.Open(s.path(vendor, name, version))
+	if os.IsNotExist(err) {
+		s.message(w, http.StatusNotFound, "Nut %s/%s version %s not found.", vendor, name, version)
+		return
+	}
+	if err != nil {
+		s.message(w, http.StatusInternalServerError, "%s", err)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		s.message(w, http.StatusInternalServerError, "%s", err)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		nf := new(NutFile)
+		err = nf.OpenReaderAt(f, fi.Size())
+		if err != nil {
+			s.message(w, http.StatusInternalServerError, "%s", err)
+			return
+		}
+		info := nf.Info()
+		info.Versions = versions
+		s.json(w, http.StatusOK, info)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"-"+version+".nut"))
+	http.ServeContent(w, r, "", fi.ModTime(), f)
+}
+
+// Returns information about the latest versions of nuts with query in vendor, name or summary.
+func (s *Server) search(w http.ResponseWriter, query string) {
+	query = strings.ToLower(query)
+	res := struct{ Nuts []*NutInfo }{[]*NutInfo{}}
+
+	vendors, err := ioutil.ReadDir(s.Dir)
+	if err != nil && !os.IsNotExist(err) {
+		s.message(w, http.StatusInternalServerError, "%s", err)
+		return
+	}
+	for _, v := range vendors {
+		if !v.IsDir() || !VendorRegexp.MatchString(v.Name()) {
+			continue
+		}
+		fis, err := ioutil.ReadDir(filepath.Join(s.Dir, v.Name()))
+		if err != nil {
+			s.message(w, http.StatusInternalServerError, "%s", err)
+			return
+		}
+
+		// collect names, then read the latest version of each nut
+		seen := make(map[string]bool)
+		for _, fi := range fis {
+			i := strings.Index(fi.Name(), "-")
+			if i <= 0 || !strings.HasSuffix(fi.Name(), ".nut") || seen[fi.Name()[:i]] {
+				continue
+			}
+			name := fi.Name()[:i]
+			seen[name] = true
+
+			versions, err := s.versions(v.Name(), name)
+			if err != nil || len(versions) == 0 {
+				continue
+			}
+			nf := new(NutFile)
+			if nf.OpenFile(s.path(v.Name(), name, latestVersion(versions).String())) != nil {
+				continue
+			}
+			info := nf.Info()
+			nf.Close()
+			info.Versions = versions
+
+			text := strings.ToLower(info.Vendor + "/" + info.Name + " " + info.Doc)
+			if strings.Contains(text, query) {
+				res.Nuts = append(res.Nuts, info)
+			}
+		}
+	}
+	s.json(w, http.StatusOK, res)
+}
+
+// Returns token from Authorization header.
+func requestToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+func (s *Server) put(w http.ResponseWriter, r *http.Request, vendor, name, version string) {
+	if s.Token == "" {
+		s.message(w, http.StatusForbidden, "Publishing is disabled.")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(requestToken(r)), []byte(s.Token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="nut"`)
+		s.message(w, http.StatusUnauthorized, "Invalid token.")
+		return
+	}
+
+	// read nut into temporary file
+	err := os.MkdirAll(filepath.Join(s.Dir, vendor), unpackDirPerm)
+	if err != nil {
+		s.message(w, http.StatusInternalServerError, "%s", err)
+		return
+	}
+	tmp, err := ioutil.TempFile(filepath.Join(s.Dir, vendor), ".put-")
+	if err != nil {
+		s.message(w, http.StatusInternalServerError, "%s", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, io.LimitReader(r.Body, MaxNutSize+1))
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		s.message(w, http.StatusInternalServerError, "%s", err)
+		return
+	}
+	if n > MaxNutSize {
+		s.message(w, http.StatusRequestEntityTooLarge, "Nut is too big: more than %d bytes.", MaxNutSize)
+		return
+	}
+
+	// check nut
+	nf := new(NutFile)
+	err = nf.OpenFile(tmp.Name())
+	if err != nil {
+		s.message(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+	defer nf.Close()
+	v, _ := NewVersion(version)
+	err = nf.CheckIdentity(vendor, name, v)
+	if err != nil {
+		s.message(w, http.StatusBadRequest, "%s", err)
+		return
+	}
+	if !s.NoCheck {
+		errors := FindingStrings(FilterFindings(nf.ConsumerFindings(s.Rules), SeverityError))
+		if len(errors) != 0 {
+			s.message(w, http.StatusBadRequest, "Found errors:\n    %s", strings.Join(errors, "\n    "))
+			return
+		}
+	}
+
+	// publish
+	s.m.Lock()
+	defer s.m.Unlock()
+	path := s.path(vendor, name, version)
+	if _, err = os.Lstat(path); err == nil {
+		s.message(w, http.StatusConflict, "Nut %s/%s version %s already exists.", vendor, name, version)
+		return
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err == nil {
+		err = os.Chmod(path, 0644)
+	}
+	if err != nil {
+		s.message(w, http.StatusInternalServerError, "%s", err)
+		return
+	}
+	s.message(w, http.StatusCreated, "Nut %s/%s version %s published.", vendor, name, version)
+}
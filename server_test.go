@@ -0,0 +1,184 @@
+package nut_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	. "."
+	. "launchpad.net/gocheck"
+)
+
+type Srv struct {
+	server *httptest.Server
+	nuts   *In
+	auth   string // Authorization header
+}
+
+var _ = Suite(&Srv{})
+
+func (s *Srv) SetUpTest(c *C) {
+	s.server = httptest.NewServer(&Server{Dir: c.MkDir(), Token: "secret"})
+	s.nuts = &In{nuts: make(map[string][]byte)}
+	s.auth = "Bearer secret"
+}
+
+func (s *Srv) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+// Makes request and returns status code, content type and body.
+func (s *Srv) do(c *C, method, path, accept string, body []byte) (code int, contentType string, b []byte) {
+	req, err := http.NewRequest(method, s.server.URL+path, bytes.NewReader(body))
+	c.Assert(err, IsNil)
+	req.Header.Set("Accept", accept)
+	if s.auth != "" {
+		req.Header.Set("Authorization", s.auth)
+	}
+	res, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	defer res.Body.Close()
+	b, err = ioutil.ReadAll(res.Body)
+	c.Assert(err, IsNil)
+	return res.StatusCode, res.Header.Get("Content-Type"), b
+}
+
+// Makes request and returns status code and message from JSON body.
+func (s *Srv) message(c *C, method, path string, body []byte) (code int, message string) {
+	code, _, b := s.do(c, method, path, "application/json", body)
+	var m struct{ Message string }
+	c.Assert(json.Unmarshal(b, &m), IsNil)
+	return code, m.Message
+}
+
+func (s *Srv) TestPublishAndGet(c *C) {
+	v1 := s.nuts.add(c, "a", "0.0.1")
+	v2 := s.nuts.add(c, "a", "0.1.0")
+	v3 := s.nuts.add(c, "a", "0.2.0-beta")
+
+	code, m := s.message(c, "GET", "/debug/a", nil)
+	c.Check(code, Equals, http.StatusNotFound)
+	c.Check(m, Equals, "Nut debug/a not found.")
+
+	for _, b := range [][]byte{v1, v2, v3} {
+		nf := new(NutFile)
+		_, err := nf.ReadFrom(bytes.NewReader(b))
+		c.Assert(err, IsNil)
+		code, m = s.message(c, "PUT", "/debug/a/"+nf.Version.String()+"", b)
+		c.Check(code, Equals, http.StatusCreated)
+		c.Check(m, Equals, "Nut debug/a version "+nf.Version.String()+" published.")
+	}
+	code, m = s.message(c, "PUT", "/debug/a/0.0.1", v1)
+	c.Check(code, Equals, http.StatusConflict)
+	c.Check(m, Equals, "Nut debug/a version 0.0.1 already exists.")
+
+	code, typ, b := s.do(c, "GET", "/debug/a", "application/json", nil)
+	c.Check(code, Equals, http.StatusOK)
+	c.Check(typ, Equals, "application/json")
+	var info NutInfo
+	c.Check(json.Unmarshal(b, &info), IsNil)
+	c.Check(info, DeepEquals, NutInfo{
+		Vendor: "debug", Name: "a", Version: &Version{Minor: 1}, Doc: "Package a is used to test nut.",
+		Authors: []Person{{FullName: "Alexey Palazhchenko"}}, Versions: []*Version{{Patch: 1}, {Minor: 1}, {Minor: 2, PreRelease: "beta"}},
+	})
+
+	code, _, b = s.do(c, "GET", "/debug/a/0.2.0-beta", "application/json", nil)
+	c.Check(code, Equals, http.StatusOK)
+	info = NutInfo{}
+	c.Check(json.Unmarshal(b, &info), IsNil)
+	c.Check(info.Version, DeepEquals, &Version{Minor: 2, PreRelease: "beta"})
+	c.Check(info.Versions, IsNil)
+
+	code, typ, b = s.do(c, "GET", "/debug/a", "application/zip", nil)
+	c.Check(code, Equals, http.StatusOK)
+	c.Check(typ, Equals, "application/zip")
+	c.Check(bytes.Equal(b, v2), Equals, true)
+
+	code, _, b = s.do(c, "GET", "/debug/a/0.0.1", "application/zip", nil)
+	c.Check(code, Equals, http.StatusOK)
+	c.Check(bytes.Equal(b, v1), Equals, true)
+
+	code, _, b = s.do(c, "GET", "/debug/a-0.2.0-beta.nut", "", nil)
+	c.Check(code, Equals, http.StatusOK)
+	c.Check(bytes.Equal(b, v3), Equals, true)
+
+	code, m = s.message(c, "GET", "/debug/a/0.3.0", nil)
+	c.Check(code, Equals, http.StatusNotFound)
+	c.Check(m, Equals, "Nut debug/a version 0.3.0 not found.")
+}
+
+func (s *Srv) TestSearch(c *C) {
+	for _, name := range []string{"a", "b"} {
+		b := s.nuts.add(c, name, "0.0.1")
+		code, _ := s.message(c, "PUT", "/debug/"+name+"/0.0.1", b)
+		c.Assert(code, Equals, http.StatusCreated)
+	}
+
+	search := func(query string) (names []string) {
+		code, _, b := s.do(c, "GET", "/-/search?q="+query, "application/json", nil)
+		c.Check(code, Equals, http.StatusOK)
+		var res struct{ Nuts []NutInfo }
+		c.Check(json.Unmarshal(b, &res), IsNil)
+		for _, info := range res.Nuts {
+			names = append(names, info.Vendor+"/"+info.Name)
+		}
+		return
+	}
+	c.Check(search(""), DeepEquals, []string{"debug/a", "debug/b"})
+	c.Check(search("Package+B"), DeepEquals, []string{"debug/b"})
+	c.Check(search("debug/a"), DeepEquals, []string{"debug/a"})
+	c.Check(search("none"), IsNil)
+}
+
+func (s *Srv) TestPublishErrors(c *C) {
+	b := s.nuts.add(c, "a", "0.0.1")
+
+	s.auth = ""
+	code, m := s.message(c, "PUT", "/debug/a/0.0.1", b)
+	c.Check(code, Equals, http.StatusUnauthorized)
+	c.Check(m, Equals, "Invalid token.")
+
+	s.auth = "Bearer wrong"
+	code, m = s.message(c, "PUT", "/debug/a/0.0.1", b)
+	c.Check(code, Equals, http.StatusUnauthorized)
+	c.Check(m, Equals, "Invalid token.")
+
+	// token in query parameter is not accepted
+	s.auth = ""
+	code, m = s.message(c, "PUT", "/debug/a/0.0.1?token=secret", b)
+	c.Check(code, Equals, http.StatusUnauthorized)
+	c.Check(m, Equals, "Invalid token.")
+
+	s.auth = "bearer secret"
+	code, m = s.message(c, "PUT", "/debug/a/0.0.1", b)
+	c.Check(code, Equals, http.StatusCreated)
+	c.Check(m, Equals, "Nut debug/a version 0.0.1 published.")
+
+	code, m = s.message(c, "PUT", "/debug/b/0.0.1", b)
+	c.Check(code, Equals, http.StatusBadRequest)
+	c.Check(m, Equals, `Expected nut name "b", got "a".`)
+
+	code, m = s.message(c, "PUT", "/debug/a/0.0.1", []byte("not a nut"))
+	c.Check(code, Equals, http.StatusBadRequest)
+	c.Check(m, Matches, ".*zip.*")
+
+	code, m = s.message(c, "PUT", "/debug/a", b)
+	c.Check(code, Equals, http.StatusNotFound)
+	code, m = s.message(c, "PUT", "/Debug/a/0.0.1", b)
+	c.Check(code, Equals, http.StatusNotFound)
+	code, m = s.message(c, "DELETE", "/debug/a/0.0.1", nil)
+	c.Check(code, Equals, http.StatusMethodNotAllowed)
+
+	// publishing is disabled without token
+	server := httptest.NewServer(&Server{Dir: c.MkDir()})
+	defer server.Close()
+	req, err := http.NewRequest("PUT", server.URL+"/debug/a/0.0.1", bytes.NewReader(b))
+	c.Assert(err, IsNil)
+	req.Header.Set("Authorization", "Bearer ")
+	res, err := http.DefaultClient.Do(req)
+	c.Assert(err, IsNil)
+	res.Body.Close()
+	c.Check(res.StatusCode, Equals, http.StatusForbidden)
+}
@@ -0,0 +1,208 @@
+package nut
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+const (
+	SignatureFileName = "nut.sig"
+)
+
+var (
+	ErrNotSigned = errors.New("Nut is not signed.")
+	ErrUntrusted = errors.New("Nut is signed with untrusted key.")
+)
+
+// Describes detached signature of nut, stored in file nut.sig inside nut.
+type Signature struct {
+	PublicKey []byte // ed25519 public key, base64-encoded in JSON
+	Signature []byte // ed25519 signature of NutFile.SignedMessage(), base64-encoded in JSON
+}
+
+// Generates new ed25519 key pair.
+func GenerateKey() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	return ed25519.GenerateKey(rand.Reader)
+}
+
+// Encodes public or private key to base64 string.
+func EncodeKey(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// Decodes base64-encoded ed25519 public key.
+func DecodePublicKey(s string) (key ed25519.PublicKey, err error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err == nil && len(b) != ed25519.PublicKeySize {
+		err = fmt.Errorf("expected %d bytes, got %d", ed25519.PublicKeySize, len(b))
+	}
+	if err != nil {
+		err = fmt.Errorf("Bad public key %q: %s", s, err)
+		return
+	}
+	key = ed25519.PublicKey(b)
+	return
+}
+
+// Decodes base64-encoded ed25519 private key.
+func DecodePrivateKey(s string) (key ed25519.PrivateKey, err error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err == nil && len(b) != ed25519.PrivateKeySize {
+		err = fmt.Errorf("expected %d bytes, got %d", ed25519.PrivateKeySize, len(b))
+	}
+	if err != nil {
+		err = fmt.Errorf("Bad private key: %s", err)
+		return
+	}
+	key = ed25519.PrivateKey(b)
+	return
+}
+
+// Returns message covered by signature: quoted names and SHA-256 hashes of all files in nut
+// except signature file, sorted by name.
+func (nf *NutFile) SignedMessage() (msg []byte, err error) {
+	files := make([]*zip.File, 0, len(nf.Reader.File))
+	for _, f := range nf.Reader.File {
+		if f.Name != SignatureFileName {
+			files = append(files, f)
+		}
+	}
+	sort.Sort(byFileName(files))
+
+	buf := bytes.NewBufferString("nut signature v1\n")
+	for _, f := range files {
+		var h string
+		h, _, err = fileHash(f)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(buf, "%s %s\n", h, strconv.Quote(f.Name))
+	}
+
+	msg = buf.Bytes()
+	return
+}
+
+// Returns signature of nut, or ErrNotSigned.
+func (nf *NutFile) Signature() (sig *Signature, err error) {
+	for _, f := range nf.Reader.File {
+		if f.Name != SignatureFileName {
+			continue
+		}
+
+		var b []byte
+		b, err = readFile(f)
+		if err != nil {
+			return
+		}
+		sig = new(Signature)
+		err = json.Unmarshal(b, sig)
+		if err != nil {
+			err = fmt.Errorf("Bad signature: %s", err)
+		}
+		return
+	}
+
+	err = ErrNotSigned
+	return
+}
+
+// Checks signature of nut. Returns ErrNotSigned if nut is not signed,
+// ErrUntrusted if signature is valid, but public key is not trusted,
+// or other error if signature is invalid.
+func (nf *NutFile) VerifySignature(trusted []ed25519.PublicKey) error {
+	sig, err := nf.Signature()
+	if err != nil {
+		return err
+	}
+
+	if len(sig.PublicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("Bad signature: public key has %d bytes.", len(sig.PublicKey))
+	}
+	msg, err := nf.SignedMessage()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(ed25519.PublicKey(sig.PublicKey), msg, sig.Signature) {
+		return fmt.Errorf("Bad signature: nut is modified or signature is corrupted.")
+	}
+
+	for _, key := range trusted {
+		if bytes.Equal(key, sig.PublicKey) {
+			return nil
+		}
+	}
+	return ErrUntrusted
+}
+
+// Signs nut with private key and writes signed nut to w.
+// Existing signature is replaced.
+func (nf *NutFile) Sign(key ed25519.PrivateKey, w io.Writer) (err error) {
+	msg, err := nf.SignedMessage()
+	if err != nil {
+		return
+	}
+	sig := &Signature{
+		PublicKey: key.Public().(ed25519.PublicKey),
+		Signature: ed25519.Sign(key, msg),
+	}
+	b, err := json.MarshalIndent(sig, "", "  ")
+	if err != nil {
+		return
+	}
+
+	zw := newZipWriter(w)
+	err = nf.copyUnsigned(zw)
+	if err != nil {
+		return
+	}
+
+	fw, err := zw.CreateHeader(NewFileHeader(SignatureFileName))
+	if err != nil {
+		return
+	}
+	_, err = fw.Write(append(b, '\n'))
+	if err != nil {
+		return
+	}
+	return zw.Close()
+}
+
+// Writes nut without signature to w. Entries are copied as is, so unsigned nut is byte-identical
+// to nut before signing.
+func (nf *NutFile) WriteUnsigned(w io.Writer) (err error) {
+	zw := newZipWriter(w)
+	err = nf.copyUnsigned(zw)
+	if err != nil {
+		return
+	}
+	return zw.Close()
+}
+
+func (nf *NutFile) copyUnsigned(zw *zip.Writer) (err error) {
+	for _, f := range nf.Reader.File {
+		if f.Name != SignatureFileName {
+			err = zw.Copy(f)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// byFileName implements sort.Interface.
+type byFileName []*zip.File
+
+func (f byFileName) Len() int           { return len(f) }
+func (f byFileName) Less(i, j int) bool { return f[i].Name < f[j].Name }
+func (f byFileName) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
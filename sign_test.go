@@ -0,0 +1,128 @@
+package nut_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"io/ioutil"
+
+	. "."
+	. "launchpad.net/gocheck"
+)
+
+type Sig struct {
+	nf      *NutFile
+	public  ed25519.PublicKey
+	private ed25519.PrivateKey
+}
+
+var _ = Suite(&Sig{})
+
+func (f *Sig) SetUpTest(c *C) {
+	f.nf = new(NutFile)
+	c.Assert(f.nf.ReadFile("../test_nut1/test_nut1-0.0.1.nut"), IsNil)
+
+	var err error
+	f.public, f.private, err = GenerateKey()
+	c.Assert(err, IsNil)
+}
+
+func (f *Sig) sign(c *C, nf *NutFile, key ed25519.PrivateKey) (signed *NutFile) {
+	buf := new(bytes.Buffer)
+	c.Assert(nf.Sign(key, buf), IsNil)
+
+	signed = new(NutFile)
+	_, err := signed.ReadFrom(buf)
+	c.Assert(err, IsNil)
+	return
+}
+
+func (f *Sig) TestSignVerify(c *C) {
+	_, err := f.nf.Signature()
+	c.Check(err, Equals, ErrNotSigned)
+	c.Check(f.nf.VerifySignature([]ed25519.PublicKey{f.public}), Equals, ErrNotSigned)
+
+	signed := f.sign(c, f.nf, f.private)
+	c.Check(signed.Spec, DeepEquals, f.nf.Spec)
+	c.Check(signed.Reader.File, HasLen, len(f.nf.Reader.File)+1)
+	c.Check(signed.VerifySignature([]ed25519.PublicKey{f.public}), IsNil)
+	c.Check(signed.VerifySignature(nil), Equals, ErrUntrusted)
+
+	msg1, err := f.nf.SignedMessage()
+	c.Assert(err, IsNil)
+	msg2, err := signed.SignedMessage()
+	c.Assert(err, IsNil)
+	c.Check(string(msg2), Equals, string(msg1))
+	c.Check(bytes.HasPrefix(msg1, []byte("nut signature v1\n")), Equals, true)
+	c.Check(bytes.Contains(msg1, []byte(` "nut.json"`+"\n")), Equals, true)
+
+	// sign again with other key
+	public2, private2, err := GenerateKey()
+	c.Assert(err, IsNil)
+	resigned := f.sign(c, signed, private2)
+	c.Check(resigned.Reader.File, HasLen, len(signed.Reader.File))
+	c.Check(resigned.VerifySignature([]ed25519.PublicKey{f.public}), Equals, ErrUntrusted)
+	c.Check(resigned.VerifySignature([]ed25519.PublicKey{f.public, public2}), IsNil)
+}
+
+func (f *Sig) TestWriteUnsigned(c *C) {
+	b, err := ioutil.ReadFile("../test_nut1/test_nut1-0.0.1.nut")
+	c.Assert(err, IsNil)
+
+	signed := f.sign(c, f.nf, f.private)
+	buf := new(bytes.Buffer)
+	c.Assert(signed.WriteUnsigned(buf), IsNil)
+	c.Check(bytes.Equal(buf.Bytes(), b), Equals, true)
+}
+
+// Returns signed nut with replaced LICENSE, with or without manifest.
+func (f *Sig) tamper(c *C, withManifest bool) *bytes.Buffer {
+	signed := f.sign(c, f.nf, f.private)
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, file := range signed.Reader.File {
+		switch file.Name {
+		case "LICENSE":
+			w, err := zw.Create(file.Name)
+			c.Assert(err, IsNil)
+			_, err = w.Write([]byte("Not a license."))
+			c.Assert(err, IsNil)
+		case ManifestFileName:
+			if withManifest {
+				c.Assert(zw.Copy(file), IsNil)
+			}
+		default:
+			c.Assert(zw.Copy(file), IsNil)
+		}
+	}
+	c.Assert(zw.Close(), IsNil)
+	return buf
+}
+
+func (f *Sig) TestTampered(c *C) {
+	tampered := new(NutFile)
+	_, err := tampered.ReadFrom(f.tamper(c, true))
+	c.Check(err, ErrorMatches, `File "LICENSE" does not match manifest: nut is truncated or modified.`)
+
+	_, err = tampered.ReadFrom(f.tamper(c, false))
+	c.Assert(err, IsNil)
+	c.Check(tampered.VerifySignature([]ed25519.PublicKey{f.public}), ErrorMatches,
+		"Bad signature: nut is modified or signature is corrupted.")
+}
+
+func (f *Sig) TestKeys(c *C) {
+	s := EncodeKey(f.public)
+	public, err := DecodePublicKey(s)
+	c.Check(err, IsNil)
+	c.Check(public, DeepEquals, f.public)
+
+	private, err := DecodePrivateKey(EncodeKey(f.private))
+	c.Check(err, IsNil)
+	c.Check(private, DeepEquals, f.private)
+
+	_, err = DecodePublicKey("AAAA")
+	c.Check(err, ErrorMatches, `Bad public key "AAAA": expected 32 bytes, got 3`)
+	_, err = DecodePrivateKey("!")
+	c.Check(err, ErrorMatches, `Bad private key: .+`)
+}
@@ -1,13 +1,17 @@
 package nut
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"go/token"
 	"io"
 	"io/ioutil"
 	"net/url"
 	"os"
+	"path"
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -16,8 +20,19 @@ type Spec struct {
 	Version    Version
 	Vendor     string
 	Authors    []Person
-	ExtraFiles []string
+	ExtraFiles []string // file and directory names, glob patterns (see MatchExtraFiles)
 	Homepage   string
+
+	// Maps import paths of nuts this nut depends on to version constraints,
+	// e.g. "gonuts.io/aleksi/nut": "^0.3". See Constraint for syntax.
+	Dependencies map[string]string `json:",omitempty"`
+
+	// Command name for binary nut (package main). It is used as nut name,
+	// and command is installed as GOPATH/bin/<Command>.
+	Command string `json:",omitempty"`
+
+	// Overrides severities of check rules, e.g. "package-doc": "off". See DefaultRules.
+	Rules Rules `json:",omitempty"`
 }
 
 // Describes nut author.
@@ -73,37 +88,50 @@ func (spec *Spec) ReadFrom(r io.Reader) (n int64, err error) {
 // Any error encountered during the write is also returned.
 // Implements io.WriterTo.
 func (spec *Spec) WriteTo(w io.Writer) (n int64, err error) {
-	var b []byte
-	b, err = json.MarshalIndent(spec, "", "  ")
+	// do not escape "<" and ">" in constraints
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(spec)
 	if err != nil {
 		return
 	}
 
-	b = append(b, '\n')
-	n1, err := w.Write(b)
+	n1, err := w.Write(buf.Bytes())
 	n = int64(n1)
 	return
 }
 
-// Checks spec for errors and return them.
-func (spec *Spec) Check() (errors []string) {
+// Checks spec for errors and return them. See Findings.
+func (spec *Spec) Check() []string {
+	return FindingStrings(spec.Findings())
+}
+
+// Checks spec and returns findings with severities overridden by spec.Rules.
+func (spec *Spec) Findings() []Finding {
+	return spec.Rules.Apply(spec.findings())
+}
+
+// Returns findings of spec with default severities.
+func (spec *Spec) findings() (findings []Finding) {
 	// check version
 	if spec.Version.String() == "0.0.0" {
-		errors = append(errors, fmt.Sprintf("Version %q is invalid.", spec.Version))
+		findings = append(findings, NewFinding(RuleVersion, "Version", "", "Version %q is invalid.", spec.Version))
 	}
 
 	// check vendor
 	if !VendorRegexp.MatchString(spec.Vendor) {
-		errors = append(errors, fmt.Sprintf(`Vendor should contain only lower word characters (match "%s").`, VendorRegexp))
+		findings = append(findings, NewFinding(RuleVendor, "Vendor", "", `Vendor should contain only lower word characters (match "%s").`, VendorRegexp))
 	}
 
 	// author should be specified
 	if len(spec.Authors) == 0 {
-		errors = append(errors, "No authors given.")
+		findings = append(findings, NewFinding(RuleAuthors, "Authors", "", "No authors given."))
 	} else {
 		for _, a := range spec.Authors {
 			if a.FullName == ExampleFullName {
-				errors = append(errors, fmt.Sprintf("%q is not a real person.", a.FullName))
+				findings = append(findings, NewFinding(RuleAuthors, "Authors", "", "%q is not a real person.", a.FullName))
 			}
 		}
 	}
@@ -117,20 +145,94 @@ func (spec *Spec) Check() (errors []string) {
 		}
 	}
 	if !licenseFound {
-		errors = append(errors, "Spec should include license file in ExtraFiles.")
+		findings = append(findings, NewFinding(RuleLicense, "ExtraFiles", "", "Spec should include license file in ExtraFiles."))
+	}
+
+	// check extra files names and patterns
+	for _, f := range spec.ExtraFiles {
+		if err := CheckFileName(f); err != nil {
+			findings = append(findings, NewFinding(RuleExtraFiles, "ExtraFiles", f, "%s", err))
+		} else if err := CheckGlob(f); err != nil {
+			findings = append(findings, NewFinding(RuleExtraFiles, "ExtraFiles", f, "%s", err))
+		}
 	}
 
 	// check homepage
 	if spec.Homepage != "" {
 		u, err := url.Parse(spec.Homepage)
 		if err != nil {
-			errors = append(errors, fmt.Sprintf("Can't parse homepage: %s", err))
+			findings = append(findings, NewFinding(RuleHomepage, "Homepage", "", "Can't parse homepage: %s", err))
 		} else {
 			if !u.IsAbs() || u.Opaque != "" || (u.Scheme != "http" && u.Scheme != "https") {
-				errors = append(errors, "Homepage should be absolute http:// or https:// URL.")
+				findings = append(findings, NewFinding(RuleHomepage, "Homepage", "", "Homepage should be absolute http:// or https:// URL."))
 			}
 		}
 	}
 
+	// check command name
+	if spec.Command != "" && (!token.IsIdentifier(spec.Command) || strings.ToLower(spec.Command) != spec.Command) {
+		findings = append(findings, NewFinding(RuleCommand, "Command", "", "Command name %q should be lower case Go identifier.", spec.Command))
+	}
+
+	// check dependencies
+	for _, imp := range spec.dependencyPaths() {
+		if _, err := NewConstraint(spec.Dependencies[imp]); err != nil {
+			findings = append(findings, NewFinding(RuleDependency, "Dependencies", "", "Dependency %q: %s", imp, err))
+		}
+	}
+
+	findings = append(findings, spec.Rules.Findings()...)
+	return
+}
+
+// Checks that dependencies are imported by package and return errors. See ImportFindings.
+func (spec *Spec) CheckImports(imports []string) []string {
+	return FindingStrings(spec.ImportFindings(imports))
+}
+
+// Checks that dependencies are imported by package and returns findings with severities overridden by spec.Rules.
+// Imports should contain all imports of package, including imports of tests.
+// Dependency is imported if its package or any package in its subdirectories is imported.
+func (spec *Spec) ImportFindings(imports []string) []Finding {
+	return spec.Rules.Apply(spec.importFindings(imports))
+}
+
+// Returns findings about unused dependencies with default severities.
+func (spec *Spec) importFindings(imports []string) (findings []Finding) {
+	imported := make(map[string]bool, len(imports))
+	for _, imp := range imports {
+		for p := imp; p != "." && p != "/"; p = path.Dir(p) {
+			imported[p] = true
+		}
+	}
+
+	for _, imp := range spec.dependencyPaths() {
+		if !imported[imp] {
+			findings = append(findings, NewFinding(RuleUnusedDependency, "Dependencies", "", "Dependency %q is not imported by package.", imp))
+		}
+	}
+	return
+}
+
+// Returns constraint for given import path, or nil if it is not declared.
+// Returns error if declared constraint is invalid.
+func (spec *Spec) DependencyConstraint(importPath string) (c *Constraint, err error) {
+	s, ok := spec.Dependencies[importPath]
+	if !ok {
+		return
+	}
+	c, err = NewConstraint(s)
+	if err != nil {
+		c, err = nil, fmt.Errorf("Dependency %q: %s", importPath, err)
+	}
+	return
+}
+
+// Returns sorted import paths of dependencies.
+func (spec *Spec) dependencyPaths() (paths []string) {
+	for imp := range spec.Dependencies {
+		paths = append(paths, imp)
+	}
+	sort.Strings(paths)
 	return
 }
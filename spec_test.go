@@ -2,6 +2,7 @@ package nut_test
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 
@@ -56,6 +57,53 @@ func (f *S) TestReadFile(c *C) {
 	c.Check(s, DeepEquals, f.s)
 }
 
+func (f *S) TestDependencies(c *C) {
+	s := *f.s
+	s.Dependencies = map[string]string{
+		"gonuts.io/debug/test_nut2": ">=0.0.2 <0.1.0",
+		"gonuts.io/debug/test_nut3": "~0.0.3",
+	}
+	c.Check(s.Check(), DeepEquals, []string(nil))
+	c.Check(s.CheckImports([]string{"fmt", "gonuts.io/debug/test_nut2", "gonuts.io/debug/test_nut3"}), DeepEquals, []string(nil))
+	c.Check(s.CheckImports([]string{"fmt", "gonuts.io/debug/test_nut3"}), DeepEquals,
+		[]string{`Dependency "gonuts.io/debug/test_nut2" is not imported by package.`})
+	constraint, err := s.DependencyConstraint("gonuts.io/debug/test_nut3")
+	c.Check(err, IsNil)
+	c.Check(constraint.String(), Equals, "~0.0.3")
+	constraint, err = s.DependencyConstraint("gonuts.io/debug/test_nut1")
+	c.Check(err, IsNil)
+	c.Check(constraint, IsNil)
+
+	// constraints are written as is
+	buf := new(bytes.Buffer)
+	_, err = s.WriteTo(buf)
+	c.Assert(err, IsNil)
+	c.Check(bytes.Contains(buf.Bytes(), []byte(`"gonuts.io/debug/test_nut2": ">=0.0.2 <0.1.0"`)), Equals, true)
+	s2 := new(Spec)
+	_, err = s2.ReadFrom(buf)
+	c.Assert(err, IsNil)
+	c.Check(s2.Dependencies, DeepEquals, s.Dependencies)
+
+	s.Dependencies["gonuts.io/debug/test_nut2"] = ">>0.0.2"
+	c.Check(s.Check(), DeepEquals,
+		[]string{`Dependency "gonuts.io/debug/test_nut2": Bad constraint ">>0.0.2": unknown operator ">>".`})
+	constraint, err = s.DependencyConstraint("gonuts.io/debug/test_nut2")
+	c.Check(err, ErrorMatches, `Dependency "gonuts.io/debug/test_nut2": Bad constraint ">>0.0.2": unknown operator ">>".`)
+	c.Check(constraint, IsNil)
+}
+
+func (f *S) TestCommand(c *C) {
+	s := *f.s
+	for _, cmd := range []string{"", "nut", "gonut2", "go_bindata"} {
+		s.Command = cmd
+		c.Check(s.Check(), DeepEquals, []string(nil), Commentf("%q", cmd))
+	}
+	for _, cmd := range []string{"Nut", "go-bindata", "../nut", "2nut"} {
+		s.Command = cmd
+		c.Check(s.Check(), DeepEquals, []string{fmt.Sprintf("Command name %q should be lower case Go identifier.", cmd)})
+	}
+}
+
 func (f *S) TestVendorFormat(c *C) {
 	c.Check(VendorRegexp.MatchString("aleksi"), Equals, true)
 	c.Check(VendorRegexp.MatchString("42"), Equals, true)
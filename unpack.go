@@ -0,0 +1,137 @@
+package nut
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	unpackDirPerm = 0755
+)
+
+// Describes options for Unpack.
+type UnpackOptions struct {
+	// If not empty, imports of packages in nut are rewritten to canonical import paths with that prefix
+	// (see Nut.RewriteImports).
+	Prefix string
+
+	// Remove existing directory before unpacking.
+	RemoveDir bool
+
+	// If not nil, called to report progress.
+	Logf func(format string, v ...interface{})
+}
+
+// Checks that existing components of directory sub in dir are directories, not symlinks or other files.
+func checkUnpackDir(dir, sub, name string) error {
+	if sub == "." {
+		return nil
+	}
+	p := dir
+	for _, part := range strings.Split(sub, "/") {
+		p = filepath.Join(p, part)
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("Can't unpack %s: %s is not a directory.", name, p)
+		}
+	}
+	return nil
+}
+
+// Unpacks nut into directory dir, overwriting existing files. Service files (signature and manifest)
+// are not unpacked. Existing symlinks and other non-regular files (including parent directories)
+// are not overwritten or followed. If opts is nil, default options are used.
+func Unpack(nf *NutFile, dir string, opts *UnpackOptions) (err error) {
+	// nf.Reader may be set directly, bypassing checks in NutFile.ReadFrom
+	err = CheckArchive(nf.Reader)
+	if err != nil {
+		return
+	}
+
+	if opts == nil {
+		opts = new(UnpackOptions)
+	}
+	logf := opts.Logf
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+
+	// check dir
+	_, err = os.Stat(dir)
+	if err == nil && opts.RemoveDir {
+		logf("Removing existing directory %s ...", dir)
+		err = os.RemoveAll(dir)
+		if err != nil {
+			return
+		}
+	}
+	err = os.MkdirAll(dir, unpackDirPerm)
+	if err != nil {
+		return
+	}
+
+	for _, file := range nf.Reader.File {
+		if IsServiceFile(file.Name) {
+			continue
+		}
+
+		logf("Unpacking %s ...", file.Name)
+		name := strings.TrimSuffix(file.Name, "/")
+		sub := path.Dir(name)
+		if file.Mode().IsDir() {
+			sub = name
+		}
+		err = checkUnpackDir(dir, sub, file.Name)
+		if err != nil {
+			return
+		}
+		dstPath := filepath.Join(dir, filepath.FromSlash(name))
+		if file.Mode().IsDir() {
+			err = os.MkdirAll(dstPath, unpackDirPerm)
+			if err != nil {
+				return
+			}
+			continue
+		}
+		err = os.MkdirAll(filepath.Dir(dstPath), unpackDirPerm)
+		if err != nil {
+			return
+		}
+
+		var b []byte
+		b, err = readFile(file)
+		if err != nil {
+			return
+		}
+		if opts.Prefix != "" {
+			b, err = nf.RewriteImports(file.Name, b, opts.Prefix)
+			if err != nil {
+				err = fmt.Errorf("Can't rewrite imports in %s: %s", file.Name, err)
+				return
+			}
+		}
+
+		// do not follow existing symlinks
+		fi, e := os.Lstat(dstPath)
+		if e == nil && !fi.Mode().IsRegular() {
+			err = fmt.Errorf("Can't unpack %s: %s is not a regular file.", file.Name, dstPath)
+			return
+		}
+
+		err = ioutil.WriteFile(dstPath, b, file.Mode().Perm())
+		if err != nil {
+			return
+		}
+	}
+	return
+}
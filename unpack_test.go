@@ -0,0 +1,105 @@
+package nut_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	. "."
+	. "launchpad.net/gocheck"
+)
+
+type U struct{}
+
+var _ = Suite(&U{})
+
+func (*U) TestUnpack(c *C) {
+	nf := new(NutFile)
+	c.Assert(nf.ReadFile("../test_nut1/test_nut1-0.0.1.nut"), IsNil)
+
+	dir := c.MkDir()
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "stray"), nil, 0644), IsNil)
+	c.Assert(Unpack(nf, dir, nil), IsNil)
+	_, err := os.Stat(filepath.Join(dir, "stray"))
+	c.Check(err, IsNil)
+	_, err = os.Stat(filepath.Join(dir, ManifestFileName))
+	c.Check(os.IsNotExist(err), Equals, true)
+	b, err := ioutil.ReadFile(filepath.Join(dir, "README"))
+	c.Assert(err, IsNil)
+	expected, err := ioutil.ReadFile("../test_nut1/README")
+	c.Assert(err, IsNil)
+	c.Check(string(b), Equals, string(expected))
+
+	// remove existing directory
+	var logged []string
+	opts := &UnpackOptions{RemoveDir: true, Logf: func(format string, v ...interface{}) { logged = append(logged, format) }}
+	c.Assert(Unpack(nf, dir, opts), IsNil)
+	_, err = os.Stat(filepath.Join(dir, "stray"))
+	c.Check(os.IsNotExist(err), Equals, true)
+	c.Check(logged[0], Equals, "Removing existing directory %s ...")
+	c.Check(logged, HasLen, 1+len(nf.Reader.File)-1)
+
+	// do not follow symlinks
+	if runtime.GOOS == "windows" {
+		return
+	}
+	c.Assert(os.Remove(filepath.Join(dir, "README")), IsNil)
+	c.Assert(os.Symlink(filepath.Join(dir, "LICENSE"), filepath.Join(dir, "README")), IsNil)
+	c.Check(Unpack(nf, dir, nil), ErrorMatches, `Can't unpack README: .+ is not a regular file.`)
+}
+
+func (*U) TestUnpackUnsafe(c *C) {
+	// reader with unchecked names
+	nf := new(NutFile)
+	b := makeNut(c, map[string]string{"../evil.go": "package evil\n"}, []string{"../evil.go"}, nil).Bytes()
+	var err error
+	nf.Reader, err = zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	c.Assert(err, IsNil)
+	dir := c.MkDir()
+	c.Check(Unpack(nf, filepath.Join(dir, "a"), nil), NotNil)
+	_, err = os.Stat(filepath.Join(dir, "evil.go"))
+	c.Check(os.IsNotExist(err), Equals, true)
+
+	// do not follow symlinked parent directories
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var names []string
+	for name := range multiFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	nf = new(NutFile)
+	_, err = nf.ReadFrom(makeNut(c, multiFiles, names, nil))
+	c.Assert(err, IsNil)
+	dir, outside := c.MkDir(), c.MkDir()
+	c.Assert(os.Symlink(outside, filepath.Join(dir, "sub")), IsNil)
+	c.Check(Unpack(nf, dir, nil), ErrorMatches, `Can't unpack sub/.*: .+/sub is not a directory.`)
+	fis, err := ioutil.ReadDir(outside)
+	c.Assert(err, IsNil)
+	c.Check(fis, HasLen, 0)
+}
+
+func (*U) TestUnpackRewrite(c *C) {
+	var names []string
+	for name := range multiFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	nf := new(NutFile)
+	_, err := nf.ReadFrom(makeNut(c, multiFiles, names, nil))
+	c.Assert(err, IsNil)
+
+	dir := c.MkDir()
+	c.Assert(Unpack(nf, dir, &UnpackOptions{Prefix: "localhost"}), IsNil)
+	b, err := ioutil.ReadFile(filepath.Join(dir, "sub", "sub.go"))
+	c.Assert(err, IsNil)
+	c.Check(string(b), Equals, "// Package sub is used to test nut.\npackage sub\n\nimport \"localhost/debug/a/sub/inner\"\n")
+	b, err = ioutil.ReadFile(filepath.Join(dir, "sub", "testdata", "t.go"))
+	c.Assert(err, IsNil)
+	c.Check(string(b), Equals, multiFiles["sub/testdata/t.go"])
+}
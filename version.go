@@ -4,16 +4,26 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
-// Current format for nut version.
-var VersionRegexp = regexp.MustCompile(`^(\d+).(\d+).(\d+)$`)
+// Current format for nut version: Semantic Versioning 2.0.0 (http://semver.org/spec/v2.0.0.html).
+var VersionRegexp = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
 
 // Describes nut version. See http://gonuts.io/-/doc/versioning for explanation of version specification.
 type Version struct {
 	Major int
 	Minor int
 	Patch int
+
+	// Dot-separated pre-release identifiers without leading "-", e.g. "beta.1".
+	PreRelease string
+
+	// Dot-separated build metadata identifiers without leading "+", e.g. "build.5".
+	// Ignored when determining version precedence.
+	Build string
 }
 
 // Parse and set version.
@@ -26,55 +36,120 @@ func NewVersion(version string) (v *Version, err error) {
 // Return version as string in current format.
 func (v Version) String() string {
 	res := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.PreRelease != "" {
+		res += "-" + v.PreRelease
+	}
+	if v.Build != "" {
+		res += "+" + v.Build
+	}
 	if !VersionRegexp.MatchString(res) { // sanity check
 		panic(fmt.Errorf("%s not matches %s", res, VersionRegexp))
 	}
 	return res
 }
 
-// Returns true if left < right, false otherwise.
-func (left *Version) Less(right *Version) bool {
-	if left.Major < right.Major {
-		return true
-	} else if left.Major > right.Major {
-		return false
+// Returns true if version has pre-release identifiers.
+func (v *Version) IsPreRelease() bool {
+	return v.PreRelease != ""
+}
+
+// Returns -1 if left < right, 0 if left == right, +1 if left > right.
+// Build metadata is ignored as required by Semantic Versioning.
+func (left *Version) Compare(right *Version) int {
+	for _, p := range [][2]int{{left.Major, right.Major}, {left.Minor, right.Minor}, {left.Patch, right.Patch}} {
+		if p[0] < p[1] {
+			return -1
+		} else if p[0] > p[1] {
+			return 1
+		}
+	}
+
+	// version without pre-release has higher precedence
+	switch {
+	case left.PreRelease == right.PreRelease:
+		return 0
+	case left.PreRelease == "":
+		return 1
+	case right.PreRelease == "":
+		return -1
 	}
 
-	if left.Minor < right.Minor {
-		return true
-	} else if left.Minor > right.Minor {
-		return false
+	l := strings.Split(left.PreRelease, ".")
+	r := strings.Split(right.PreRelease, ".")
+	for i := 0; i < len(l) && i < len(r); i++ {
+		if c := compareIdentifiers(l[i], r[i]); c != 0 {
+			return c
+		}
 	}
 
-	if left.Patch < right.Patch {
-		return true
-	} else if left.Patch > right.Patch {
-		return false
+	// larger set of pre-release fields has higher precedence
+	switch {
+	case len(l) < len(r):
+		return -1
+	case len(l) > len(r):
+		return 1
 	}
+	return 0
+}
 
-	// left == right => "left < right" is false
-	return false
+// Compares pre-release identifiers: numeric identifiers are compared numerically and
+// have lower precedence than alphanumeric ones, which are compared lexically in ASCII order.
+func compareIdentifiers(left, right string) int {
+	ln, lerr := strconv.ParseUint(left, 10, 64)
+	rn, rerr := strconv.ParseUint(right, 10, 64)
+	switch {
+	case lerr == nil && rerr == nil:
+		switch {
+		case ln < rn:
+			return -1
+		case ln > rn:
+			return 1
+		}
+		return 0
+	case lerr == nil:
+		return -1
+	case rerr == nil:
+		return 1
+	}
+	return strings.Compare(left, right)
+}
+
+// Returns true if left < right, false otherwise.
+func (left *Version) Less(right *Version) bool {
+	return left.Compare(right) < 0
 }
 
 // Marshal to JSON.
 func (v *Version) MarshalJSON() ([]byte, error) {
-	return []byte(fmt.Sprintf(`"%s"`, v)), nil
+	return []byte(strconv.Quote(v.String())), nil
 }
 
 // Unmarshal from JSON.
 func (v *Version) UnmarshalJSON(b []byte) error {
-	return v.setVersion(string(b[1 : len(b)-1]))
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return fmt.Errorf("Bad JSON for version %s: %s", b, err)
+	}
+	return v.setVersion(s)
 }
 
 func (v *Version) setVersion(version string) (err error) {
-	parsed := VersionRegexp.FindAllStringSubmatch(version, -1)
-	if (parsed == nil) || (len(parsed[0]) != 4) {
+	parsed := VersionRegexp.FindStringSubmatch(version)
+	if len(parsed) != 6 {
 		err = fmt.Errorf("Bad format for version %q. See http://gonuts.io/-/doc/versioning", version)
 		return
 	}
 
-	v.Major, _ = strconv.Atoi(parsed[0][1])
-	v.Minor, _ = strconv.Atoi(parsed[0][2])
-	v.Patch, _ = strconv.Atoi(parsed[0][3])
+	var res Version
+	for i, p := range []*int{&res.Major, &res.Minor, &res.Patch} {
+		*p, err = strconv.Atoi(parsed[i+1])
+		if err != nil {
+			err = fmt.Errorf("Bad format for version %q: %s", version, err)
+			return
+		}
+	}
+	res.PreRelease = parsed[4]
+	res.Build = parsed[5]
+	*v = res
 	return
 }
@@ -18,12 +18,15 @@ func (f *V) SetUpSuite(c *C) {
 	f.versions = []string{
 		"0.0.0", "0.0.1", "0.0.2",
 		"0.1.0", "0.1.1", "0.1.2",
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1",
 		"1.0.0", "1.0.1", "1.0.2",
 		"1.1.0", "1.1.1", "1.1.2",
 		"1.1.10", "1.10.1", "10.1.1", "10.10.10",
 	}
 	f.badVersions = []string{
-		"1.0.-1",
+		"1.0.-1", "1.0", "1.0.0.0", "01.0.0", "1.00.0",
+		"1.0.0-", "1.0.0+", "1.0.0-01", "1.0.0-alpha..1", "1.0.0-alpha_1", "1.0.0+build..1",
 	}
 }
 
@@ -59,6 +62,30 @@ func (f *V) TestLess(c *C) {
 	}
 }
 
+func (f *V) TestPreReleaseBuild(c *C) {
+	v, err := NewVersion("1.2.0-beta.1+build.5")
+	c.Assert(err, IsNil)
+	c.Check(*v, Equals, Version{Major: 1, Minor: 2, Patch: 0, PreRelease: "beta.1", Build: "build.5"})
+	c.Check(v.String(), Equals, "1.2.0-beta.1+build.5")
+	c.Check(v.IsPreRelease(), Equals, true)
+
+	// build metadata does not affect precedence
+	for _, pair := range [][2]string{
+		{"1.2.0+build.5", "1.2.0"},
+		{"1.2.0+build.5", "1.2.0+build.6"},
+		{"1.2.0-rc.1+a", "1.2.0-rc.1+b"},
+	} {
+		left, err := NewVersion(pair[0])
+		c.Assert(err, IsNil)
+		right, err := NewVersion(pair[1])
+		c.Assert(err, IsNil)
+		c.Check(left.Compare(right), Equals, 0, Commentf("Expected %s == %s", left, right))
+		c.Check(left.Less(right), Equals, false)
+		c.Check(right.Less(left), Equals, false)
+		c.Check(left.IsPreRelease(), Equals, pair[0] == "1.2.0-rc.1+a")
+	}
+}
+
 func (f *V) TestJSON(c *C) {
 	for _, vs := range f.versions {
 		v, err := NewVersion(vs)
@@ -73,4 +100,10 @@ func (f *V) TestJSON(c *C) {
 		c.Check(v2, DeepEquals, v)
 		c.Assert(err, IsNil)
 	}
+
+	v := new(Version)
+	c.Check(json.Unmarshal([]byte(`"1.2.0-beta.1+build.5"`), v), IsNil)
+	c.Check(v.String(), Equals, "1.2.0-beta.1+build.5")
+	c.Check(json.Unmarshal([]byte(`123`), v), Not(IsNil))
+	c.Check(json.Unmarshal([]byte(`"1.2"`), v), Not(IsNil))
 }